@@ -1,41 +1,244 @@
+// 任务调度器演示，依赖图等扩展功能拆分在 workOne4_*.go 中
+// 运行方式: go run $(ls workOne4*.go | grep -v _test.go)
+// 运行测试: go test workOne4*.go
+// 执行任务文件: go run $(ls workOne4*.go | grep -v _test.go) -job workOne4_job.json
+// 输出 JUnit 报告: go run $(ls workOne4*.go | grep -v _test.go) -job workOne4_job.json -report junit -report-file report.xml
+// 执行时查看和取消任务: go run $(ls workOne4*.go | grep -v _test.go) -job workOne4_job.json -admin :8080
+// 执行器性能对比: go test -run '^$' -bench Fork workOne4*.go
+// 分布式执行: go run $(ls workOne4*.go | grep -v _test.go) -coordinator :9000 -job workOne4_job.json
+//
+//	再在其他终端启动 worker: go run $(ls workOne4*.go | grep -v _test.go) -worker http://localhost:9000
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// 任务类型定义
+// 任务类型定义（旧接口，无法感知取消）
 type Task func() error
 
+// 支持上下文取消的任务类型
+type ContextTask func(ctx context.Context) error
+
+// 将旧的 func() error 任务适配为 ContextTask
+// 注意：旧任务本身无法被中断，取消后调度器只是不再等待它
+func AdaptTask(task Task) ContextTask {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			// 旧任务在单独的协程中运行，panic 需要在这里捕获
+			defer func() {
+				if r := recover(); r != nil {
+					done <- newPanicError(r)
+				}
+			}()
+			done <- task()
+		}()
+
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// 任务状态
+type TaskStatus int
+
+const (
+	StatusSuccess   TaskStatus = iota // 成功
+	StatusFailed                      // 任务返回错误
+	StatusTimeout                     // 超过调度器设置的超时时间
+	StatusCancelled                   // 被调度器或父上下文取消
+	StatusSkipped                     // 上游依赖失败，未执行
+	StatusPanicked                    // 任务发生 panic
+	StatusRejected                    // 分组熔断器打开，未执行
+)
+
+func (s TaskStatus) String() string {
+	switch s {
+	case StatusSuccess:
+		return "成功"
+	case StatusFailed:
+		return "失败"
+	case StatusTimeout:
+		return "超时"
+	case StatusCancelled:
+		return "已取消"
+	case StatusSkipped:
+		return "已跳过"
+	case StatusPanicked:
+		return "崩溃"
+	case StatusRejected:
+		return "已熔断"
+	default:
+		return "未知"
+	}
+}
+
+// 任务超时错误
+var ErrTaskTimeout = errors.New("任务执行超时")
+
+// 任务选项
+type TaskOptions struct {
+	Name      string       // 任务名称，仅用于展示
+	DependsOn []int        // 依赖的任务ID，只能引用已添加的任务
+	Retry     *RetryPolicy // 重试策略，nil 表示使用调度器默认策略
+	Priority  int          // 优先级，数值越大越先执行
+	Group     string       // 分组，同组任务共享限流和并发限制
+	Tenant    string       // 租户，不同租户按 SetTenantWeight 的权重分享 worker
+	Key       string       // 幂等键，服务模式下按 SetDedupe 的方式处理重复提交
+	Resources Resources    // 声明的资源占用，配合 SetResourceBudget 使用
+}
+
+// 任务运行状态
+type taskState int
+
+const (
+	stateIdle    taskState = iota // 已添加，尚未提交执行
+	stateWaiting                  // 等待上游任务完成
+	stateQueued                   // 在就绪队列中
+	stateRunning                  // 正在执行
+	stateDone                     // 已结束
+)
+
+// 管理接口中使用的任务状态
+func (s taskState) String() string {
+	switch s {
+	case stateWaiting:
+		return "waiting"
+	case stateQueued:
+		return "queued"
+	case stateRunning:
+		return "running"
+	case stateDone:
+		return "finished"
+	default:
+		return "added"
+	}
+}
+
+// 调度器内部保存的任务
+type taskEntry struct {
+	name      string
+	fn        ContextTask
+	deps      []int        // 依赖的任务ID
+	retry     *RetryPolicy // 任务级重试策略
+	priority  int
+	group     string
+	tenant    string
+	key       string
+	resources Resources
+
+	// 命名任务的类型和参数，普通闭包任务为空
+	typeName  string
+	payload   json.RawMessage
+	journalID string // 写入日志时使用的ID
+
+	// 运行时状态，由 ts.mu 保护
+	state      taskState
+	pending    int           // 尚未完成的依赖数
+	dependents []int         // 下游任务ID
+	done       chan struct{} // 任务结束时关闭
+	queuedAt   time.Time     // 进入就绪队列的时间
+	startedAt  time.Time     // 被 worker 取出的时间
+	cancelled  bool          // 是否被 CancelTask 取消
+	cancel     context.CancelFunc
+	result     TaskResult // 结束后的结果
+}
+
 // 任务结果
 type TaskResult struct {
-	TaskID    int
-	StartTime time.Time
-	EndTime   time.Time
-	Duration  time.Duration
-	Error     error
-	Success   bool
+	TaskID             int
+	Name               string
+	StartTime          time.Time
+	EndTime            time.Time
+	Duration           time.Duration
+	Error              error
+	Success            bool
+	Status             TaskStatus
+	Attempts           []AttemptResult     // 每次尝试的记录
+	QueuedAt           time.Time           // 进入就绪队列的时间
+	QueueWait          time.Duration       // 在队列中等待的时间
+	Panic              *PanicError         // 任务 panic 时记录的值和堆栈
+	Group              string              // 任务所属分组
+	Tenant             string              // 任务所属租户
+	ThrottleWait       time.Duration       // 因分组限流或并发限制等待的时间
+	AdmissionWait      time.Duration       // 因资源预算不足等待的时间
+	Started            bool                // 任务函数是否被调用过，取消、跳过或熔断的任务为 false
+	BreakerTransitions []BreakerTransition // 这个任务引起的分组熔断器状态变化
 }
 
 // 任务调度器
 type TaskScheduler struct {
-	tasks      []Task
-	results    []TaskResult
+	tasks      []*taskEntry // 下标为 任务ID-base，已清理的任务为 nil
+	base       int          // tasks[0] 的任务ID，更早的任务已被清理
+	history    time.Duration
+	finished   []finishedTask // 按结束顺序排列，用于清理
 	mu         sync.Mutex
-	wg         sync.WaitGroup
+	workers    sync.WaitGroup // 运行中的工作协程
+	inflight   sync.WaitGroup // 已提交但尚未结束的任务
+	queue      *readyQueue
+	running    bool // 工作协程是否已启动
+	accepting  bool // 是否接受新提交的任务
 	maxWorkers int
 	timeout    time.Duration
+	retry      RetryPolicy   // 默认重试策略
+	repanic    bool          // 任务 panic 后是否重新抛出
+	aging      time.Duration // 优先级老化间隔
+	clock      Clock
+	recurring  []*RecurringJob    // 运行中的周期任务
+	registry   *TaskRegistry      // 命名任务注册表
+	journal    *Journal           // 预写日志，nil 表示不记录
+	groups     *groupLimiter      // 分组限流
+	breakers   *breakerSet        // 分组熔断
+	resources  *resourcePool      // 资源预算
+	weights    map[string]float64 // 租户权重
+	dedupe     DedupePolicy       // 重复提交的处理方式
+	retention  time.Duration      // 成功任务的幂等键保留时间
+	keys       map[string]*dedupeKey
+	expiry     []keyExpiry        // 按过期时间排序
+	autoscale  *AutoscaleOptions  // 自动扩缩容，nil 表示固定数量的 worker
+	poolSize   int                // 当前 worker 数
+	busy       int                // 正在执行任务的 worker 数
+	scaling    []ScaleEvent       // 扩缩容记录
+	observers  []Observer         // 事件观察者
+	events     *eventDispatcher   // 在锁外按顺序通知观察者
+	startedAt  time.Time          // 本次运行启动 worker 的时间
+	stoppedAt  time.Time          // 本次运行所有 worker 退出的时间
+	quiet      atomic.Bool        // 是否关闭默认的控制台输出
+	paused     atomic.Bool        // 是否暂停分发
+	idle       *sync.Cond         // 运行中的任务全部结束时通知，使用 ts.mu
+	sim        *Simulation        // 模拟模式，nil 表示使用真实时间
+	executor   ExecutorKind       // 执行 Fork 子任务的执行器
+	pool       forkPool           // 当前运行的子任务队列
+	cancel     context.CancelFunc // 当前运行的取消函数
 }
 
 // 新建任务调度器
 func NewTaskScheduler(maxWorkers int) *TaskScheduler {
-	return &TaskScheduler{
-		tasks:      make([]Task, 0),
-		results:    make([]TaskResult, 0),
+	ts := &TaskScheduler{
+		tasks:      make([]*taskEntry, 0),
 		maxWorkers: maxWorkers,
+		history:    defaultHistory,
+		clock:      realClock{},
+		groups:     newGroupLimiter(),
+		breakers:   newBreakerSet(),
+		resources:  &resourcePool{},
+		events:     newEventDispatcher(),
 	}
+	ts.idle = sync.NewCond(&ts.mu)
+	return ts
 }
 
 // 设置超时时间
@@ -45,234 +248,592 @@ func (ts *TaskScheduler) SetTimeout(timeout time.Duration) {
 
 // 添加任务
 func (ts *TaskScheduler) AddTask(task Task) {
-	ts.tasks = append(ts.tasks, task)
+	ts.AddContextTask(AdaptTask(task))
 }
 
 // 添加多个任务
 func (ts *TaskScheduler) AddTasks(tasks []Task) {
-	ts.tasks = append(ts.tasks, tasks...)
+	for _, task := range tasks {
+		ts.AddTask(task)
+	}
+}
+
+// 添加支持取消的任务
+func (ts *TaskScheduler) AddContextTask(task ContextTask) {
+	ts.AddTaskWithOptions(task, TaskOptions{})
+}
+
+// 添加多个支持取消的任务
+func (ts *TaskScheduler) AddContextTasks(tasks []ContextTask) {
+	for _, task := range tasks {
+		ts.AddContextTask(task)
+	}
+}
+
+// 按选项添加任务，返回任务ID
+// 添加的任务在下一次 RunSerial/RunParallel 时执行
+func (ts *TaskScheduler) AddTaskWithOptions(task ContextTask, opts TaskOptions) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	entry, err := ts.newEntryLocked(task, opts)
+	if err != nil {
+		return -1, err
+	}
+	ts.tasks = append(ts.tasks, entry)
+	return ts.nextIDLocked() - 1, nil
+}
+
+// 根据选项创建任务，依赖只能引用已添加的任务
+func (ts *TaskScheduler) newEntryLocked(task ContextTask, opts TaskOptions) (*taskEntry, error) {
+	for _, dep := range opts.DependsOn {
+		if _, err := ts.lookupLocked(dep); err != nil {
+			return nil, err
+		}
+	}
+
+	return &taskEntry{
+		name:      opts.Name,
+		fn:        task,
+		deps:      append([]int(nil), opts.DependsOn...),
+		retry:     opts.Retry,
+		priority:  opts.Priority,
+		group:     opts.Group,
+		tenant:    opts.Tenant,
+		key:       opts.Key,
+		resources: opts.Resources,
+	}, nil
+}
+
+// 取消当前运行中的所有任务
+func (ts *TaskScheduler) Cancel() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.cancel != nil {
+		ts.cancel()
+	}
+}
+
+// 启动 n 个工作协程，parent 被取消时所有任务都会收到取消信号
+// scalable 为 true 且开启了自动扩缩容时，worker 数在 MinWorkers 和 MaxWorkers 之间调整
+func (ts *TaskScheduler) startWorkers(parent context.Context, n int, scalable bool) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.running {
+		return ErrSchedulerRunning
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	ts.cancel = cancel
+	ts.queue = newReadyQueue(ts.clock, ts.aging, ts.weights)
+	// 取消时唤醒所有等待中的 worker
+	context.AfterFunc(ctx, ts.queue.wake)
+	ts.running = true
+	ts.accepting = true
+	ts.poolSize = 0
+	ts.busy = 0
+	ts.scaling = nil
+	ts.startedAt = ts.clock.Now()
+	ts.breakers.resetHistory()
+	ts.stoppedAt = time.Time{}
+
+	if ts.sim != nil {
+		// 模拟模式下由模拟器按虚拟时间执行任务，不启动工作协程
+		ts.sim.start(ctx, n)
+		return nil
+	}
+	// 空闲的 worker 等待就绪任务时也执行其他任务 Fork 的子任务
+	ts.pool = newForkPool(ts.executor, ts.queue.wakeIdle)
+	ts.queue.forkWork = ts.pool.hasWork
+	if scalable && ts.autoscale != nil {
+		opts := ts.autoscale.withDefaults(ts.maxWorkers)
+		n = opts.MinWorkers
+		ts.workers.Add(1)
+		go ts.autoscaler(ctx, ts.queue, ts.clock, opts)
+	}
+	ts.spawnWorkersLocked(ctx, n)
+	return nil
+}
+
+// 启动 n 个工作协程
+func (ts *TaskScheduler) spawnWorkersLocked(ctx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		ts.poolSize++
+		ts.workers.Add(1)
+		go ts.worker(ctx, ts.queue, ts.pool)
+	}
 }
 
 // 串行执行任务
 func (ts *TaskScheduler) RunSerial() {
-	fmt.Println("=== 串行执行任务 ===")
-	ts.results = make([]TaskResult, len(ts.tasks))
+	ts.RunSerialContext(context.Background())
+}
 
-	for i, task := range ts.tasks {
-		result := ts.executeTask(i, task)
-		ts.results[i] = result
-		ts.printTaskResult(result)
-	}
+// 串行执行任务，parent 被取消时停止后续任务
+func (ts *TaskScheduler) RunSerialContext(parent context.Context) {
+	ts.logf("=== 串行执行任务 ===\n")
 
-	ts.printSummary()
+	// 串行即只有一个 worker，每次取出优先级最高的就绪任务执行
+	ts.runBatch(parent, 1)
 }
 
 // 并行执行任务（使用工作池）
 func (ts *TaskScheduler) RunParallel() {
-	fmt.Println("=== 并行执行任务（工作池模式）===")
+	ts.RunParallelContext(context.Background())
+}
+
+// 并行执行任务，parent 被取消时停止所有任务
+func (ts *TaskScheduler) RunParallelContext(parent context.Context) {
+	ts.logf("=== 并行执行任务（工作池模式）===\n")
+	ts.runBatch(parent, ts.maxWorkers)
+}
+
+// 执行所有已添加的任务，等待全部结束后打印摘要
+func (ts *TaskScheduler) runBatch(parent context.Context, workers int) {
+	ts.mu.Lock()
+	_, err := ts.topoOrder()
 	taskCount := len(ts.tasks)
-	ts.results = make([]TaskResult, taskCount)
+	ts.mu.Unlock()
+
+	if err == nil {
+		err = ts.startWorkers(parent, min(workers, taskCount), workers > 1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法执行: %v\n", err)
+		return
+	}
+
+	// 重置上一次运行的状态后提交所有任务
+	ts.mu.Lock()
+	ts.finished = nil
+	for _, entry := range ts.tasks {
+		if entry != nil {
+			entry.state = stateIdle
+			entry.dependents = nil
+			entry.result = TaskResult{}
+		}
+	}
+	for i, entry := range ts.tasks {
+		if entry != nil {
+			ts.activateLocked(ts.base + i)
+		}
+	}
+	ts.mu.Unlock()
+
+	if ts.sim != nil {
+		ts.sim.run(ts)
+	}
+	ts.Drain()
+	ts.ReportSummary()
+}
+
+// 工作协程：从就绪队列中取任务执行，没有就绪任务时执行排队的子任务，队列关闭后退出
+func (ts *TaskScheduler) worker(ctx context.Context, queue *readyQueue, pool forkPool) {
+	defer ts.workers.Done()
+
+	w := pool.attach()
+	defer pool.detach(w)
+	ctx = context.WithValue(ctx, forkWorkerKey{}, forkWorker{pool, w})
+
+	admit := ts.admitFunc(ctx)
+	for {
+		item, ok := queue.pop(admit)
+		if !ok {
+			return
+		}
+		if item == nil {
+			pool.help(w)
+			continue
+		}
+		ts.runItem(ctx, queue, item)
+	}
+}
+
+// 出队前的准入检查：先申请资源再检查分组限流，取消后不再限制，让排队的任务尽快结束
+func (ts *TaskScheduler) admitFunc(ctx context.Context) admitFunc {
+	return func(item *queuedTask) (bool, time.Time) {
+		if ctx.Err() != nil {
+			ts.resources.forget(item)
+			return true, time.Time{}
+		}
+		if ts.paused.Load() {
+			return false, time.Time{}
+		}
+		now := ts.clock.Now()
+		if !ts.resources.tryAcquire(item) {
+			if item.admitWaitFrom.IsZero() {
+				item.admitWaitFrom = now
+			}
+			return false, time.Time{}
+		}
+		ok, retryAt := ts.groups.tryAcquire(item, now)
+		if !ok {
+			// 只归还资源，等待资源的位置保留到出队为止
+			ts.resources.release(item)
+			if item.throttledAt.IsZero() {
+				item.throttledAt = now
+			}
+		}
+		return ok, retryAt
+	}
+}
+
+// 执行一个出队的任务并记录结果
+func (ts *TaskScheduler) runItem(ctx context.Context, queue *readyQueue, item *queuedTask) {
+	// 出队后不再占着等待资源的位置，放回被它挡住的任务
+	if ts.resources.forget(item) {
+		queue.wakeBlocked()
+	}
+
+	// 每个任务使用单独的上下文，CancelTask 只取消这一个任务
+	taskCtx, cancel := context.WithCancel(ts.taskContext(ctx, item.taskID))
+	ts.mu.Lock()
+	entry := ts.entryLocked(item.taskID)
+	entry.state = stateRunning
+	entry.startedAt = ts.clock.Now()
+	entry.cancel = cancel
+	if entry.cancelled {
+		cancel()
+	}
+	ts.busy++
+	ts.journalStartLocked(entry)
+	event := ts.taskEvent(item.taskID, entry)
+	ts.notifyLocked(func(o Observer) { o.OnStart(event) })
+	ts.mu.Unlock()
+
+	result := ts.runQueued(taskCtx, item, entry)
+	cancel()
+	queue.finish(item)
+	if item.holdsGroup || item.holdsResources {
+		if item.holdsGroup {
+			ts.groups.release(entry.group)
+		}
+		ts.resources.release(item)
+		queue.wakeBlocked()
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.busy--
+	if ts.busy == 0 {
+		ts.idle.Broadcast()
+	}
+	entry.cancel = nil
+	if entry.cancelled && result.Status == StatusCancelled {
+		result.Error = ErrTaskCancelled
+	}
+	ts.finishLocked(result)
+}
 
-	// 创建任务通道
-	taskChan := make(chan int, taskCount)
-	resultChan := make(chan TaskResult, taskCount)
+// 提交任务：依赖都已成功则进入就绪队列，否则等待上游完成
+func (ts *TaskScheduler) activateLocked(taskID int) {
+	entry := ts.entryLocked(taskID)
+	entry.done = make(chan struct{})
+	entry.pending = 0
+	entry.cancelled = false
+	entry.queuedAt = time.Time{}
+	entry.startedAt = time.Time{}
+	ts.inflight.Add(1)
 
-	// 启动工作协程
-	for i := 0; i < ts.maxWorkers && i < taskCount; i++ {
-		ts.wg.Add(1)
-		go ts.worker(taskChan, resultChan)
+	for _, dep := range entry.deps {
+		upstream := ts.entryLocked(dep)
+		if upstream.state != stateDone {
+			entry.pending++
+			upstream.dependents = append(upstream.dependents, taskID)
+			continue
+		}
+		if !upstream.result.Success {
+			// 上游已经失败，直接跳过
+			ts.finishLocked(ts.skippedResult(taskID, upstream.result))
+			return
+		}
 	}
 
-	// 发送任务到通道
-	for i := range ts.tasks {
-		taskChan <- i
+	if entry.pending > 0 {
+		entry.state = stateWaiting
+		return
 	}
-	close(taskChan)
+	ts.enqueueLocked(taskID)
+}
+
+// 任务进入就绪队列
+func (ts *TaskScheduler) enqueueLocked(taskID int) {
+	entry := ts.entryLocked(taskID)
+	entry.state = stateQueued
+	entry.queuedAt = ts.clock.Now()
+	ts.queue.push(taskID, entry)
+	event := ts.taskEvent(taskID, entry)
+	ts.notifyLocked(func(o Observer) { o.OnQueued(event) })
+}
+
+func (ts *TaskScheduler) taskEvent(taskID int, entry *taskEntry) TaskEvent {
+	return TaskEvent{TaskID: taskID, Name: entry.name, Group: entry.group, Time: ts.clock.Now()}
+}
 
-	// 收集结果
-	go func() {
-		ts.wg.Wait()
-		close(resultChan)
-	}()
+// 执行队列中取出的任务，并记录排队时间
+func (ts *TaskScheduler) runQueued(ctx context.Context, item *queuedTask, entry *taskEntry) TaskResult {
+	result := ts.executeTask(ctx, item.taskID, entry)
+	result.QueuedAt = item.enqueuedAt
+	result.QueueWait = result.StartTime.Sub(item.enqueuedAt)
+	if !item.throttledAt.IsZero() {
+		result.ThrottleWait = result.StartTime.Sub(item.throttledAt)
+	}
+	if !item.admitWaitFrom.IsZero() {
+		result.AdmissionWait = result.StartTime.Sub(item.admitWaitFrom)
+	}
+	return result
+}
 
-	// 处理结果
-	for result := range resultChan {
-		ts.results[result.TaskID] = result
-		ts.printTaskResult(result)
+// 记录任务结果：成功则释放下游任务，失败则跳过所有下游任务
+func (ts *TaskScheduler) finishLocked(result TaskResult) {
+	entry := ts.entryLocked(result.TaskID)
+	entry.state = stateDone
+	entry.result = result
+	if ts.history > 0 {
+		ts.finished = append(ts.finished, finishedTask{taskID: result.TaskID, at: ts.clock.Now()})
 	}
+	ts.journalFinishLocked(entry, result)
+	ts.releaseKeyLocked(entry, result)
+	ts.notifyLocked(func(o Observer) { o.OnFinish(result) })
+	close(entry.done)
+	ts.inflight.Done()
+
+	for _, next := range entry.dependents {
+		downstream := ts.entryLocked(next)
+		if downstream.state != stateWaiting {
+			continue
+		}
 
-	ts.printSummary()
+		if !result.Success {
+			ts.finishLocked(ts.skippedResult(next, result))
+			continue
+		}
+
+		downstream.pending--
+		if downstream.pending == 0 {
+			ts.enqueueLocked(next)
+		}
+	}
 }
 
-// 工作协程
-func (ts *TaskScheduler) worker(taskChan <-chan int, resultChan chan<- TaskResult) {
-	defer ts.wg.Done()
+// 执行单个任务，失败时按重试策略重试
+func (ts *TaskScheduler) executeTask(ctx context.Context, taskID int, entry *taskEntry) TaskResult {
+	policy := ts.retryPolicy(entry)
+	result := TaskResult{
+		TaskID: taskID,
+		Name:   entry.name,
+		Group:  entry.group,
+		Tenant: entry.tenant,
+	}
+
+	for attempt := 1; ; attempt++ {
+		willRun := ctx.Err() == nil
+		a := ts.guardedAttempt(ctx, attempt, taskID, entry, &result)
+		result.Attempts = append(result.Attempts, a)
+		if willRun && a.Status != StatusRejected {
+			result.Started = true
+		}
+
+		if !policy.shouldRetry(attempt, a) {
+			break
+		}
+
+		event := RetryEvent{
+			TaskEvent: ts.taskEvent(taskID, entry),
+			Attempt:   attempt,
+			Backoff:   policy.backoff(attempt, RandFrom(ctx)),
+			Error:     a.Error,
+		}
+		ts.notify(func(o Observer) { o.OnRetry(event) })
+		if !sleepContext(ctx, event.Backoff) {
+			break
+		}
+	}
+
+	first := result.Attempts[0]
+	last := result.Attempts[len(result.Attempts)-1]
+	result.StartTime = first.StartTime
+	result.EndTime = last.EndTime
+	result.Duration = last.EndTime.Sub(first.StartTime)
+	result.Error = last.Error
+	result.Status = last.Status
+	result.Success = last.Status == StatusSuccess
+	errors.As(last.Error, &result.Panic)
 
-	for taskID := range taskChan {
-		result := ts.executeTask(taskID, ts.tasks[taskID])
-		resultChan <- result
+	// 退避期间被取消时，以取消作为最终状态
+	if !result.Success && ctx.Err() != nil && result.Status != StatusCancelled {
+		result.Error = ctx.Err()
+		result.Status = StatusCancelled
 	}
+	return result
 }
 
-// 执行单个任务
-func (ts *TaskScheduler) executeTask(taskID int, task Task) TaskResult {
-	startTime := time.Now()
+// 执行一次尝试
+func (ts *TaskScheduler) executeAttempt(ctx context.Context, attempt int, task ContextTask) AttemptResult {
+	startTime := ts.clock.Now()
 	var err error
-	var success bool
 
-	if ts.timeout > 0 {
+	if ctx.Err() != nil {
+		// 运行已被取消，不再启动新任务
+		err = ctx.Err()
+	} else if ts.timeout > 0 {
 		// 带超时执行
-		err = ts.executeWithTimeout(task)
+		err = ts.executeWithTimeout(ctx, task)
 	} else {
 		// 普通执行
-		err = task()
+		err = safeCall(ctx, task)
 	}
 
-	endTime := time.Now()
+	endTime := ts.clock.Now()
 
-	if err == nil {
-		success = true
+	var pe *PanicError
+	if ts.repanic && errors.As(err, &pe) {
+		panic(pe)
 	}
 
-	return TaskResult{
-		TaskID:    taskID,
+	return AttemptResult{
+		Attempt:   attempt,
 		StartTime: startTime,
 		EndTime:   endTime,
 		Duration:  endTime.Sub(startTime),
 		Error:     err,
-		Success:   success,
+		Status:    classifyError(ctx, err),
 	}
 }
 
-// 带超时执行任务
-func (ts *TaskScheduler) executeWithTimeout(task Task) error {
-	done := make(chan error, 1)
+// 带超时执行任务，超时后通过上下文通知任务停止
+func (ts *TaskScheduler) executeWithTimeout(ctx context.Context, task ContextTask) error {
+	taskCtx, cancel := withTimeoutCause(ctx, ts.timeout, ErrTaskTimeout)
+	defer cancel()
 
-	go func() {
-		done <- task()
-	}()
-
-	select {
-	case err := <-done:
+	err := safeCall(taskCtx, task)
+	var pe *PanicError
+	if errors.As(err, &pe) {
 		return err
-	case <-time.After(ts.timeout):
-		return fmt.Errorf("任务执行超时")
 	}
-}
-
-// 打印单个任务结果
-func (ts *TaskScheduler) printTaskResult(result TaskResult) {
-	status := "✓ 成功"
-	if !result.Success {
-		status = "✗ 失败"
+	if err != nil && !errors.Is(err, ErrTaskTimeout) && ctx.Err() == nil && context.Cause(taskCtx) == ErrTaskTimeout {
+		return fmt.Errorf("%w: %v", ErrTaskTimeout, err)
 	}
+	return err
+}
 
-	fmt.Printf("任务 %d [%s] - 耗时: %v",
-		result.TaskID+1, status, result.Duration)
-
-	if result.Error != nil {
-		fmt.Printf(" - 错误: %v", result.Error)
+// 根据错误和运行上下文判断任务状态
+func classifyError(ctx context.Context, err error) TaskStatus {
+	switch {
+	case err == nil:
+		return StatusSuccess
+	case errors.As(err, new(*PanicError)):
+		return StatusPanicked
+	case errors.Is(err, ErrTaskTimeout):
+		return StatusTimeout
+	case ctx.Err() != nil:
+		return StatusCancelled
+	default:
+		return StatusFailed
 	}
-	fmt.Println()
 }
 
-// 打印执行摘要
-func (ts *TaskScheduler) printSummary() {
-	var totalDuration time.Duration
-	successCount := 0
-	failureCount := 0
+// 获取执行结果，按任务ID排序，服务模式下已被清理的任务不再包含
+func (ts *TaskScheduler) GetResults() []TaskResult {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
 
-	for _, result := range ts.results {
-		totalDuration += result.Duration
-		if result.Success {
-			successCount++
-		} else {
-			failureCount++
+	results := make([]TaskResult, 0, len(ts.tasks))
+	for _, entry := range ts.tasks {
+		if entry != nil {
+			results = append(results, entry.result)
 		}
 	}
-
-	avgDuration := totalDuration / time.Duration(len(ts.results))
-
-	fmt.Printf("\n=== 执行摘要 ===\n")
-	fmt.Printf("总任务数: %d\n", len(ts.tasks))
-	fmt.Printf("成功: %d\n", successCount)
-	fmt.Printf("失败: %d\n", failureCount)
-	fmt.Printf("总耗时: %v\n", totalDuration)
-	fmt.Printf("平均耗时: %v\n", avgDuration)
-	fmt.Printf("成功率: %.1f%%\n", float64(successCount)/float64(len(ts.tasks))*100)
-	fmt.Println()
-}
-
-// 获取执行结果
-func (ts *TaskScheduler) GetResults() []TaskResult {
-	return ts.results
+	return results
 }
 
 // 重置调度器
 func (ts *TaskScheduler) Reset() {
-	ts.tasks = make([]Task, 0)
-	ts.results = make([]TaskResult, 0)
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.tasks = make([]*taskEntry, 0)
+	ts.base = 0
+	ts.finished = nil
 }
 
-// 示例任务函数
-func createSampleTasks() []Task {
-	return []Task{
+// 示例任务函数，通过 Sleep 和 RandFrom 等待和取随机数，在模拟模式下可以重放
+func createSampleTasks() []ContextTask {
+	return []ContextTask{
 		// 快速任务
-		func() error {
-			time.Sleep(100 * time.Millisecond)
+		func(ctx context.Context) error {
+			if err := Sleep(ctx, 100*time.Millisecond); err != nil {
+				return err
+			}
 			fmt.Println("   快速任务完成")
 			return nil
 		},
 		// 中等任务
-		func() error {
-			time.Sleep(300 * time.Millisecond)
+		func(ctx context.Context) error {
+			if err := Sleep(ctx, 300*time.Millisecond); err != nil {
+				return err
+			}
 			fmt.Println("   中等任务完成")
 			return nil
 		},
 		// 慢速任务
-		func() error {
-			time.Sleep(500 * time.Millisecond)
+		func(ctx context.Context) error {
+			if err := Sleep(ctx, 500*time.Millisecond); err != nil {
+				return err
+			}
 			fmt.Println("   慢速任务完成")
 			return nil
 		},
 		// 可能失败的任务
-		func() error {
-			time.Sleep(200 * time.Millisecond)
-			if time.Now().Unix()%2 == 0 {
+		func(ctx context.Context) error {
+			if err := Sleep(ctx, 200*time.Millisecond); err != nil {
+				return err
+			}
+			if RandFrom(ctx).Intn(2) == 0 {
 				return fmt.Errorf("随机失败")
 			}
 			fmt.Println("   可能失败的任务完成")
 			return nil
 		},
 		// 计算密集型任务
-		func() error {
-			start := time.Now()
+		func(ctx context.Context) error {
+			start := Now(ctx)
 			// 模拟计算
 			for i := 0; i < 1000000; i++ {
 				_ = i * i
 			}
-			fmt.Printf("   计算任务完成，耗时: %v\n", time.Since(start))
+			fmt.Printf("   计算任务完成，耗时: %v\n", Now(ctx).Sub(start))
 			return nil
 		},
 		// 网络请求模拟
-		func() error {
-			time.Sleep(400 * time.Millisecond)
+		func(ctx context.Context) error {
+			if err := Sleep(ctx, 400*time.Millisecond); err != nil {
+				return err
+			}
 			fmt.Println("   网络任务完成")
 			return nil
 		},
 	}
 }
 
-// 创建会超时的任务
-func createTimeoutTasks() []Task {
-	return []Task{
-		func() error {
-			time.Sleep(2 * time.Second)
+// 创建会超时的任务，超时后任务会收到取消信号并退出
+func createTimeoutTasks() []ContextTask {
+	return []ContextTask{
+		func(ctx context.Context) error {
+			if err := Sleep(ctx, 2*time.Second); err != nil {
+				fmt.Println("   超时任务收到取消信号，提前退出")
+				return err
+			}
 			fmt.Println("   这个任务应该会超时")
 			return nil
 		},
-		func() error {
-			time.Sleep(500 * time.Millisecond)
+		func(ctx context.Context) error {
+			if err := Sleep(ctx, 500*time.Millisecond); err != nil {
+				return err
+			}
 			fmt.Println("   这个任务应该能完成")
 			return nil
 		},
@@ -280,7 +841,34 @@ func createTimeoutTasks() []Task {
 }
 
 func main() {
-	fmt.Println("=== Go 任务调度器演示 ===\n")
+	jobFile := flag.String("job", "", "执行 JSON 任务文件，有任务失败时以非 0 状态码退出")
+	report := flag.String("report", "text", "任务文件的报告格式: text、jsonl、junit、json 或 csv")
+	reportFile := flag.String("report-file", "", "报告写入的文件，默认输出到标准输出")
+	coordinatorAddr := flag.String("coordinator", "", "以协调者模式执行任务文件，监听这个地址，例如 :9000")
+	leaseTTL := flag.Duration("lease", 5*time.Second, "协调者模式下的租约时间")
+	workerURL := flag.String("worker", "", "以远程 worker 模式运行，连接这个协调者地址，例如 http://localhost:9000")
+	workerID := flag.String("worker-id", "", "远程 worker 的名称，默认为主机名和进程号")
+	concurrency := flag.Int("concurrency", 2, "远程 worker 同时执行的任务数")
+	grace := flag.Duration("grace", 10*time.Second, "收到 SIGINT 或 SIGTERM 后等待运行中任务结束的时间")
+	adminAddr := flag.String("admin", "", "执行任务文件时在这个地址提供 HTTP 管理接口，例如 :8080")
+	flag.Parse()
+
+	if *workerURL != "" {
+		os.Exit(runRemoteWorker(*workerURL, *workerID, *concurrency, *grace))
+	}
+	if *coordinatorAddr != "" {
+		if *jobFile == "" {
+			fmt.Fprintln(os.Stderr, "协调者模式需要用 -job 指定任务文件")
+			os.Exit(2)
+		}
+		os.Exit(runCoordinator(*coordinatorAddr, *jobFile, *leaseTTL, *grace))
+	}
+
+	if *jobFile != "" {
+		os.Exit(runJobFile(*jobFile, *report, *reportFile, *grace, *adminAddr))
+	}
+
+	fmt.Print("=== Go 任务调度器演示 ===\n\n")
 
 	// 演示1：串行 vs 并行执行
 	demoSerialVsParallel()
@@ -290,6 +878,81 @@ func main() {
 
 	// 演示3：大量任务处理
 	demoLargeTaskSet()
+
+	// 演示4：取消正在运行的任务
+	demoCancellation()
+
+	// 演示5：按依赖关系执行任务
+	demoDependencyGraph()
+
+	// 演示6：失败重试
+	demoRetry()
+
+	// 演示7：按优先级调度
+	demoPriority()
+
+	// 演示8：常驻服务模式
+	demoServiceMode()
+
+	// 演示9：周期任务
+	demoRecurring()
+
+	// 演示10：任务 panic 隔离
+	demoPanicIsolation()
+
+	// 演示11：任务日志与重启恢复
+	demoJournal()
+
+	// 演示12：声明式任务文件
+	demoJobFile()
+
+	// 演示13：分组限流
+	demoRateLimit()
+
+	// 演示14：自动扩缩容
+	demoAutoscale()
+
+	// 演示15：事件观察者与报告输出
+	demoReporters()
+
+	// 演示16：Prometheus 指标
+	demoMetrics()
+
+	// 演示17：执行统计与导出
+	demoStats()
+
+	// 演示18：带返回值的任务
+	demoFutures()
+
+	// 演示19：远程 worker 分布式执行
+	demoDistributed()
+
+	// 演示20：分组熔断
+	demoCircuitBreaker()
+
+	// 演示21：幂等键去重
+	demoDedupe()
+
+	// 演示22：按资源占用调度
+	demoResources()
+
+	// 演示23：暂停、恢复与优雅停止
+	demoShutdown()
+
+	// 演示24：HTTP 管理接口
+	demoAdmin()
+
+	// 演示25：多租户加权公平调度
+	demoTenants()
+
+	// 演示26：确定性模拟
+	demoSimulation()
+
+	// 演示27：并行 map/filter/reduce
+	demoParallelHelpers()
+
+	// 演示28：工作窃取执行器
+	demoWorkStealing()
 }
 
 func demoSerialVsParallel() {
@@ -299,12 +962,12 @@ func demoSerialVsParallel() {
 
 	// 串行执行
 	scheduler1 := NewTaskScheduler(3)
-	scheduler1.AddTasks(tasks)
+	scheduler1.AddContextTasks(tasks)
 	scheduler1.RunSerial()
 
 	// 并行执行
 	scheduler2 := NewTaskScheduler(3)
-	scheduler2.AddTasks(tasks)
+	scheduler2.AddContextTasks(tasks)
 	scheduler2.RunParallel()
 }
 
@@ -314,7 +977,7 @@ func demoTimeoutControl() {
 	tasks := createTimeoutTasks()
 
 	scheduler := NewTaskScheduler(2)
-	scheduler.AddTasks(tasks)
+	scheduler.AddContextTasks(tasks)
 	scheduler.SetTimeout(1 * time.Second) // 设置1秒超时
 	scheduler.RunParallel()
 }
@@ -322,20 +985,47 @@ func demoTimeoutControl() {
 func demoLargeTaskSet() {
 	fmt.Println("演示3：大量任务处理")
 
-	// 创建20个任务
-	var tasks []Task
-	for i := 0; i < 20; i++ {
+	// 20 项输入，每项作为一个任务执行
+	ids := make([]int, 20)
+	for i := range ids {
+		ids[i] = i
+	}
+
+	scheduler := NewTaskScheduler(5) // 使用5个worker
+	scheduler.Start()
+	durations, err := ParallelMap(context.Background(), scheduler, ids, func(ctx context.Context, id int) (time.Duration, error) {
+		// 睡眠时间 100-500ms
+		sleepTime := time.Duration(100+(id*20)%400) * time.Millisecond
+		if err := Sleep(ctx, sleepTime); err != nil {
+			return 0, err
+		}
+		fmt.Printf("   任务 %d 完成\n", id)
+		return sleepTime, nil
+	}, ParallelOptions{Task: TaskOptions{Name: "睡眠"}})
+	scheduler.Drain()
+	scheduler.ReportSummary()
+	fmt.Printf("各任务的睡眠时间: %v，错误: %v\n", durations, err)
+}
+
+func demoCancellation() {
+	fmt.Println("演示4：取消正在运行的任务")
+
+	scheduler := NewTaskScheduler(2)
+	for i := 0; i < 4; i++ {
 		taskID := i
-		tasks = append(tasks, func() error {
-			// 随机睡眠时间 100-500ms
-			sleepTime := time.Duration(100+(taskID*20)%400) * time.Millisecond
-			time.Sleep(sleepTime)
-			fmt.Printf("   任务 %d 完成\n", taskID)
-			return nil
+		scheduler.AddContextTask(func(ctx context.Context) error {
+			select {
+			case <-time.After(time.Duration(200+taskID*300) * time.Millisecond):
+				fmt.Printf("   任务 %d 完成\n", taskID)
+				return nil
+			case <-ctx.Done():
+				fmt.Printf("   任务 %d 被取消\n", taskID)
+				return ctx.Err()
+			}
 		})
 	}
 
-	scheduler := NewTaskScheduler(5) // 使用5个worker
-	scheduler.AddTasks(tasks)
+	// 600ms 后取消整个调度器
+	time.AfterFunc(600*time.Millisecond, scheduler.Cancel)
 	scheduler.RunParallel()
 }
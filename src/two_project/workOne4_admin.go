@@ -0,0 +1,486 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTaskCancelled = errors.New("任务被手动取消")
+	ErrTaskFinished  = errors.New("任务已结束")
+)
+
+// 任务的当前状态
+type TaskInfo struct {
+	TaskID    int
+	Name      string
+	Group     string
+	Tenant    string
+	Type      string // 命名任务的类型，普通闭包任务为空
+	Priority  int
+	State     string      // added、waiting、queued、running 或 finished
+	QueuedAt  time.Time   // 进入就绪队列的时间
+	StartedAt time.Time   // 开始执行的时间
+	Result    *TaskResult // 已结束的任务的结果
+}
+
+// 所有任务的当前状态
+func (ts *TaskScheduler) Tasks() []TaskInfo {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	infos := make([]TaskInfo, 0, len(ts.tasks))
+	for i, entry := range ts.tasks {
+		if entry != nil {
+			infos = append(infos, ts.taskInfoLocked(ts.base+i))
+		}
+	}
+	return infos
+}
+
+// 单个任务的当前状态
+func (ts *TaskScheduler) TaskInfo(taskID int) (TaskInfo, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if _, err := ts.lookupLocked(taskID); err != nil {
+		return TaskInfo{}, err
+	}
+	return ts.taskInfoLocked(taskID), nil
+}
+
+func (ts *TaskScheduler) taskInfoLocked(taskID int) TaskInfo {
+	entry := ts.entryLocked(taskID)
+	info := TaskInfo{
+		TaskID:    taskID,
+		Name:      entry.name,
+		Group:     entry.group,
+		Tenant:    entry.tenant,
+		Type:      entry.typeName,
+		Priority:  entry.priority,
+		State:     entry.state.String(),
+		QueuedAt:  entry.queuedAt,
+		StartedAt: entry.startedAt,
+	}
+	if entry.state == stateDone {
+		result := entry.result
+		info.Result = &result
+	}
+	return info
+}
+
+// 取消单个任务：排队或等待依赖的任务直接结束，运行中的任务收到取消信号
+// 结果状态为已取消，错误为 ErrTaskCancelled，下游任务会被跳过
+// 开启日志时取消会写入日志，重启后不再执行
+func (ts *TaskScheduler) CancelTask(taskID int) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.cancelTaskLocked(taskID)
+}
+
+func (ts *TaskScheduler) cancelTaskLocked(taskID int) error {
+	entry, err := ts.lookupLocked(taskID)
+	if err != nil {
+		return err
+	}
+	switch entry.state {
+	case stateIdle:
+		return fmt.Errorf("%w: %d", ErrTaskNotSubmitted, taskID)
+	case stateDone:
+		return fmt.Errorf("%w: %d", ErrTaskFinished, taskID)
+	}
+	if entry.cancelled {
+		return nil
+	}
+	entry.cancelled = true
+
+	switch entry.state {
+	case stateRunning:
+		entry.cancel()
+	case stateQueued:
+		item := ts.queue.remove(taskID)
+		if item == nil {
+			// 已被 worker 取出但还没开始执行，worker 看到标记后不会执行它
+			return nil
+		}
+		ts.resources.forget(item)
+		ts.queue.wake()
+		ts.finishLocked(ts.cancelledResult(taskID))
+	case stateWaiting:
+		ts.finishLocked(ts.cancelledResult(taskID))
+	}
+	return nil
+}
+
+// 没有开始执行就被取消的任务的结果
+func (ts *TaskScheduler) cancelledResult(taskID int) TaskResult {
+	entry := ts.entryLocked(taskID)
+	now := ts.clock.Now()
+	result := TaskResult{
+		TaskID:    taskID,
+		Name:      entry.name,
+		Group:     entry.group,
+		Tenant:    entry.tenant,
+		StartTime: now,
+		EndTime:   now,
+		Error:     ErrTaskCancelled,
+		Status:    StatusCancelled,
+		QueuedAt:  entry.queuedAt,
+	}
+	if !entry.queuedAt.IsZero() {
+		result.QueueWait = now.Sub(entry.queuedAt)
+	}
+	return result
+}
+
+// 调度器的 HTTP 管理接口，默认返回 JSON，请求带 ?format=html 或浏览器访问时返回 HTML 页面
+// 任务ID与报告中一致，从 1 开始
+//
+//	GET  /tasks              任务列表，可以用 ?state=queued,running 过滤
+//	POST /tasks              按类型名提交任务，需要先设置任务注册表
+//	GET  /tasks/{id}         单个任务的状态和结果
+//	POST /tasks/{id}/cancel  取消任务
+//	GET  /summary            已结束任务的执行摘要
+type Admin struct {
+	ts  *TaskScheduler
+	mux *http.ServeMux
+}
+
+func NewAdmin(ts *TaskScheduler) *Admin {
+	a := &Admin{ts: ts, mux: http.NewServeMux()}
+	a.mux.HandleFunc("GET /tasks", a.listTasks)
+	a.mux.HandleFunc("POST /tasks", a.submitTask)
+	a.mux.HandleFunc("GET /tasks/{id}", a.getTask)
+	a.mux.HandleFunc("POST /tasks/{id}/cancel", a.cancelTask)
+	a.mux.HandleFunc("GET /summary", a.summary)
+	return a
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// 管理接口中的任务
+type taskInfoReport struct {
+	TaskID    int         `json:"task_id"`
+	Name      string      `json:"name,omitempty"`
+	Group     string      `json:"group,omitempty"`
+	Tenant    string      `json:"tenant,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	Priority  int         `json:"priority"`
+	State     string      `json:"state"`
+	QueuedAt  time.Time   `json:"queued_at,omitzero"`
+	StartedAt time.Time   `json:"started_at,omitzero"`
+	WaitMs    float64     `json:"wait_ms,omitempty"`    // 排队中的任务已经等待的时间
+	RunningMs float64     `json:"running_ms,omitempty"` // 运行中的任务已经执行的时间
+	Result    *taskReport `json:"result,omitempty"`
+}
+
+func newTaskInfoReport(info TaskInfo, now time.Time) taskInfoReport {
+	report := taskInfoReport{
+		TaskID:    info.TaskID + 1,
+		Name:      info.Name,
+		Group:     info.Group,
+		Tenant:    info.Tenant,
+		Type:      info.Type,
+		Priority:  info.Priority,
+		State:     info.State,
+		QueuedAt:  info.QueuedAt,
+		StartedAt: info.StartedAt,
+	}
+	switch info.State {
+	case "queued":
+		report.WaitMs = millis(now.Sub(info.QueuedAt))
+	case "running":
+		report.RunningMs = millis(now.Sub(info.StartedAt))
+	case "finished":
+		result := newTaskReport(*info.Result)
+		report.Result = &result
+	}
+	return report
+}
+
+// 提交任务的请求，依赖使用从 1 开始的任务ID
+type submitRequest struct {
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	Name      string          `json:"name"`
+	Priority  int             `json:"priority"`
+	Group     string          `json:"group"`
+	Tenant    string          `json:"tenant"`
+	Key       string          `json:"key"`
+	DependsOn []int           `json:"depends_on"`
+	CPU       int             `json:"cpu"`
+	MemoryMB  int             `json:"memory_mb"`
+}
+
+func (a *Admin) listTasks(w http.ResponseWriter, r *http.Request) {
+	var states []string
+	if s := r.URL.Query().Get("state"); s != "" {
+		states = strings.Split(s, ",")
+	}
+
+	now := time.Now()
+	reports := []taskInfoReport{}
+	for _, info := range a.ts.Tasks() {
+		if states == nil || slices.Contains(states, info.State) {
+			reports = append(reports, newTaskInfoReport(info, now))
+		}
+	}
+
+	if wantsHTML(r) {
+		renderHTML(w, taskListPage, reports)
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func (a *Admin) getTask(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %s", ErrUnknownTask, r.PathValue("id")))
+		return
+	}
+	info, err := a.ts.TaskInfo(taskID - 1)
+	if err != nil {
+		writeError(w, taskError(err, r.PathValue("id")))
+		return
+	}
+
+	report := newTaskInfoReport(info, time.Now())
+	if wantsHTML(r) {
+		renderHTML(w, taskPage, report)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (a *Admin) cancelTask(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err == nil {
+		err = a.ts.CancelTask(taskID - 1)
+	} else {
+		err = fmt.Errorf("%w: %s", ErrUnknownTask, r.PathValue("id"))
+	}
+	if err != nil {
+		writeError(w, taskError(err, r.PathValue("id")))
+		return
+	}
+
+	// 页面上的取消按钮提交后回到任务页面，使用相对地址以便挂载在其他路径下
+	if wantsHTML(r) {
+		w.Header().Set("Location", "../"+r.PathValue("id"))
+		w.WriteHeader(http.StatusSeeOther)
+		return
+	}
+	info, _ := a.ts.TaskInfo(taskID - 1)
+	writeJSON(w, http.StatusAccepted, newTaskInfoReport(info, time.Now()))
+}
+
+func (a *Admin) submitTask(w http.ResponseWriter, r *http.Request) {
+	var req submitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	opts := TaskOptions{
+		Name:      req.Name,
+		Priority:  req.Priority,
+		Group:     req.Group,
+		Tenant:    req.Tenant,
+		Key:       req.Key,
+		Resources: Resources{CPU: req.CPU, MemoryMB: req.MemoryMB},
+	}
+	for _, dep := range req.DependsOn {
+		opts.DependsOn = append(opts.DependsOn, dep-1)
+	}
+	taskID, err := a.ts.SubmitNamed(req.Type, req.Payload, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	info, _ := a.ts.TaskInfo(taskID)
+	writeJSON(w, http.StatusCreated, newTaskInfoReport(info, time.Now()))
+}
+
+func (a *Admin) summary(w http.ResponseWriter, r *http.Request) {
+	summary := a.ts.Summary()
+	if wantsHTML(r) {
+		var b strings.Builder
+		summary.WriteText(&b)
+		renderHTML(w, summaryPage, b.String())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	summary.WriteJSON(w)
+}
+
+func wantsHTML(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "html"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// 调度器返回的错误中任务ID从 0 开始，换成请求中的ID
+func taskError(err error, id string) error {
+	for _, target := range []error{ErrUnknownTask, ErrTaskEvicted, ErrTaskNotSubmitted, ErrTaskFinished} {
+		if errors.Is(err, target) {
+			return fmt.Errorf("%w: %s", target, id)
+		}
+	}
+	return err
+}
+
+// 按错误类型返回状态码
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, ErrUnknownTask), errors.Is(err, ErrTaskEvicted):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrTaskFinished), errors.Is(err, ErrDuplicateTask):
+		status = http.StatusConflict
+	case errors.Is(err, ErrSchedulerStopped):
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func renderHTML(w http.ResponseWriter, page *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, data); err != nil {
+		fmt.Fprintf(w, "<p>%s</p>", template.HTMLEscapeString(err.Error()))
+	}
+}
+
+// 页面中的链接都是相对地址
+const pageStyle = `<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px}</style>`
+
+var taskListPage = template.Must(template.New("tasks").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>任务列表</title>` + pageStyle + `</head><body>
+<h1>任务列表</h1>
+<p><a href="?format=html&state=queued,running">只看排队和运行中</a> | <a href="?format=html">全部</a> | <a href="summary?format=html">执行摘要</a></p>
+<table>
+<tr><th>ID</th><th>名称</th><th>分组</th><th>状态</th><th>等待/执行(ms)</th><th>结果</th><th></th></tr>
+{{range .}}<tr>
+<td><a href="tasks/{{.TaskID}}?format=html">{{.TaskID}}</a></td><td>{{.Name}}</td><td>{{.Group}}</td><td>{{.State}}</td>
+<td>{{if .WaitMs}}{{printf "%.0f" .WaitMs}}{{end}}{{if .RunningMs}}{{printf "%.0f" .RunningMs}}{{end}}{{with .Result}}{{printf "%.0f" .DurationMs}}{{end}}</td>
+<td>{{with .Result}}{{.Status}}{{end}}</td>
+<td>{{if not .Result}}<form method="post" action="tasks/{{.TaskID}}/cancel?format=html"><button>取消</button></form>{{end}}</td>
+</tr>{{end}}
+</table>
+</body></html>`))
+
+var taskPage = template.Must(template.New("task").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>任务 {{.TaskID}}</title>` + pageStyle + `</head><body>
+<h1>任务 {{.TaskID}} {{.Name}}</h1>
+<p><a href="../tasks?format=html">返回任务列表</a></p>
+<table>
+<tr><th>状态</th><td>{{.State}}</td></tr>
+<tr><th>分组</th><td>{{.Group}}</td></tr>
+<tr><th>类型</th><td>{{.Type}}</td></tr>
+<tr><th>优先级</th><td>{{.Priority}}</td></tr>
+{{if not .QueuedAt.IsZero}}<tr><th>入队时间</th><td>{{.QueuedAt.Format "15:04:05.000"}}</td></tr>{{end}}
+{{if not .StartedAt.IsZero}}<tr><th>开始时间</th><td>{{.StartedAt.Format "15:04:05.000"}}</td></tr>{{end}}
+{{with .Result}}
+<tr><th>结果</th><td>{{.Status}}</td></tr>
+<tr><th>耗时(ms)</th><td>{{printf "%.1f" .DurationMs}}</td></tr>
+<tr><th>排队(ms)</th><td>{{printf "%.1f" .QueueWaitMs}}</td></tr>
+<tr><th>尝试次数</th><td>{{.Attempts}}</td></tr>
+{{if .Error}}<tr><th>错误</th><td>{{.Error}}</td></tr>{{end}}
+{{end}}
+</table>
+{{if not .Result}}<form method="post" action="{{.TaskID}}/cancel?format=html"><button>取消任务</button></form>{{end}}
+</body></html>`))
+
+var summaryPage = template.Must(template.New("summary").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>执行摘要</title>` + pageStyle + `</head><body>
+<p><a href="tasks?format=html">返回任务列表</a></p>
+<pre>{{.}}</pre>
+</body></html>`))
+
+// 发送请求并输出响应的 JSON
+func adminCall(method, baseURL, path, body string) {
+	req, _ := http.NewRequest(method, baseURL+path, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("请求失败: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	fmt.Printf("%s %s -> %d\n%s", method, path, resp.StatusCode, data)
+}
+
+func demoAdmin() {
+	fmt.Println("演示24：HTTP 管理接口")
+
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetRegistry(NewBuiltinRegistry())
+	scheduler.Start()
+
+	url, stop, err := serveLocal(NewAdmin(scheduler))
+	if err != nil {
+		fmt.Printf("启动 HTTP 服务失败: %v\n\n", err)
+		return
+	}
+	defer stop()
+
+	// 通过接口提交 3 个任务，只有 1 个 worker，后两个在排队
+	for i := 1; i <= 3; i++ {
+		body := fmt.Sprintf(`{"type": "sleep", "name": "导出%d", "payload": {"millis": 200}}`, i)
+		resp, err := http.Post(url+"/tasks", "application/json", strings.NewReader(body))
+		if err != nil {
+			fmt.Printf("提交失败: %v\n", err)
+			return
+		}
+		resp.Body.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	var running []taskInfoReport
+	resp, _ := http.Get(url + "/tasks?state=queued,running")
+	json.NewDecoder(resp.Body).Decode(&running)
+	resp.Body.Close()
+	for _, t := range running {
+		fmt.Printf("任务 %d(%s): %s\n", t.TaskID, t.Name, t.State)
+	}
+
+	// 取消运行中的任务 1 和排队中的任务 3
+	adminCall(http.MethodPost, url, "/tasks/1/cancel", "")
+	adminCall(http.MethodPost, url, "/tasks/3/cancel", "")
+	adminCall(http.MethodPost, url, "/tasks/9/cancel", "")
+
+	result, _ := scheduler.Wait(1)
+	fmt.Printf("任务 2 %s，排队 %v\n", result.Status, result.QueueWait.Round(10*time.Millisecond))
+	adminCall(http.MethodPost, url, "/tasks", `{"type": "unknown"}`)
+
+	var summary summaryReport
+	resp, _ = http.Get(url + "/summary")
+	json.NewDecoder(resp.Body).Decode(&summary)
+	resp.Body.Close()
+	fmt.Printf("摘要: 共 %d 个，成功 %d，失败 %d\n", summary.Total, summary.Succeeded, summary.Failed)
+
+	scheduler.Drain()
+	fmt.Println()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func adminRequest(t *testing.T, admin *Admin, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s 返回的不是 JSON 对象: %s", method, path, rec.Body)
+	}
+	return rec.Code, resp
+}
+
+func TestAdminStatusCodesAndTaskIDs(t *testing.T) {
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetRegistry(newBuiltinRegistry(io.Discard))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Drain()
+	admin := NewAdmin(scheduler)
+
+	// 第一个任务在调度器内部的ID是 0，接口中是 1
+	code, resp := adminRequest(t, admin, "POST", "/tasks", `{"type": "sleep", "name": "第一个", "payload": {"millis": 0}}`)
+	if code != http.StatusCreated || resp["task_id"] != 1.0 {
+		t.Fatalf("提交任务返回 %d %v，应为 201 且 task_id 为 1", code, resp)
+	}
+	scheduler.Wait(0)
+
+	code, resp = adminRequest(t, admin, "GET", "/tasks/1", "")
+	if code != http.StatusOK || resp["task_id"] != 1.0 || resp["name"] != "第一个" {
+		t.Errorf("查询任务 1 返回 %d %v", code, resp)
+	}
+
+	// 依赖也使用从 1 开始的ID
+	code, resp = adminRequest(t, admin, "POST", "/tasks", `{"type": "sleep", "payload": {"millis": 0}, "depends_on": [1]}`)
+	if code != http.StatusCreated || resp["task_id"] != 2.0 {
+		t.Errorf("提交依赖任务 1 的任务返回 %d %v", code, resp)
+	}
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		id                 string // 错误信息中应当出现的ID
+	}{
+		{"GET", "/tasks/99", "", http.StatusNotFound, "99"},
+		{"GET", "/tasks/abc", "", http.StatusNotFound, "abc"},
+		{"POST", "/tasks/1/cancel", "", http.StatusConflict, "1"},
+		{"POST", "/tasks/99/cancel", "", http.StatusNotFound, "99"},
+		{"POST", "/tasks", `{"type": "不存在的类型"}`, http.StatusBadRequest, ""},
+		{"POST", "/tasks", `{`, http.StatusBadRequest, ""},
+	}
+	for _, c := range cases {
+		code, resp := adminRequest(t, admin, c.method, c.path, c.body)
+		if code != c.status {
+			t.Errorf("%s %s 返回 %d，应为 %d", c.method, c.path, code, c.status)
+		}
+		if msg, _ := resp["error"].(string); c.id != "" && !strings.HasSuffix(msg, ": "+c.id) {
+			t.Errorf("%s %s 的错误 %q 应当使用请求中的ID %s", c.method, c.path, msg, c.id)
+		}
+	}
+}
+
+func TestAdminCancelQueuedTask(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Drain()
+	admin := NewAdmin(scheduler)
+
+	release := make(chan struct{})
+	blocker, _ := scheduler.Submit(func(ctx context.Context) error {
+		<-release
+		return nil
+	}, TaskOptions{})
+	queued, _ := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{})
+
+	code, resp := adminRequest(t, admin, "POST", "/tasks/2/cancel", "")
+	if code != http.StatusAccepted || resp["state"] != "finished" {
+		t.Errorf("取消排队中的任务返回 %d %v，应为 202 且状态为 finished", code, resp)
+	}
+	close(release)
+	scheduler.Wait(blocker)
+	if result, _ := scheduler.Wait(queued); result.Status != StatusCancelled {
+		t.Errorf("被取消的任务状态为 %v，应为已取消", result.Status)
+	}
+}
+
+func TestAdminEvictedTaskUsesRequestID(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetClock(clock)
+	scheduler.SetHistory(time.Minute)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Drain()
+	admin := NewAdmin(scheduler)
+
+	noop := func(ctx context.Context) error { return nil }
+	old, _ := scheduler.Submit(noop, TaskOptions{})
+	scheduler.Wait(old)
+	clock.Advance(2 * time.Minute)
+	latest, _ := scheduler.Submit(noop, TaskOptions{})
+	scheduler.Wait(latest)
+
+	for _, req := range [][2]string{{"GET", "/tasks/1"}, {"POST", "/tasks/1/cancel"}} {
+		code, resp := adminRequest(t, admin, req[0], req[1], "")
+		msg, _ := resp["error"].(string)
+		if code != http.StatusNotFound || !strings.HasSuffix(msg, ": 1") {
+			t.Errorf("%s %s 返回 %d %q，应为 404 且使用请求中的ID 1", req[0], req[1], code, msg)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 自动扩缩容参数，零值字段使用默认值
+type AutoscaleOptions struct {
+	MinWorkers  int           // 最少 worker 数，默认 1
+	MaxWorkers  int           // 最多 worker 数，默认为 NewTaskScheduler 的 maxWorkers
+	QueueDepth  int           // 平均每个 worker 积压超过这么多任务时扩容，默认 1
+	QueueWait   time.Duration // 最早入队的任务等待超过这个时间时扩容，0 表示不检查
+	IdleTimeout time.Duration // 有 worker 空闲超过这个时间时缩容，默认 1s
+	Interval    time.Duration // 检查间隔，默认 50ms
+}
+
+func (o AutoscaleOptions) withDefaults(maxWorkers int) AutoscaleOptions {
+	if o.MinWorkers <= 0 {
+		o.MinWorkers = 1
+	}
+	if o.MaxWorkers <= 0 {
+		o.MaxWorkers = maxWorkers
+	}
+	o.MaxWorkers = max(o.MaxWorkers, o.MinWorkers)
+	if o.QueueDepth <= 0 {
+		o.QueueDepth = 1
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = time.Second
+	}
+	if o.Interval <= 0 {
+		o.Interval = 50 * time.Millisecond
+	}
+	return o
+}
+
+// 一次扩缩容记录
+type ScaleEvent struct {
+	Time       time.Time
+	From       int
+	To         int
+	Reason     string
+	QueueDepth int           // 决策时队列中的任务数
+	QueueWait  time.Duration // 决策时最早入队任务已等待的时间
+}
+
+// 开启自动扩缩容，下次 Start 或 RunParallel 时生效，串行执行不受影响
+func (ts *TaskScheduler) SetAutoscale(opts AutoscaleOptions) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.autoscale = &opts
+}
+
+// 当前的 worker 数，缩容时为调整后的目标值
+func (ts *TaskScheduler) PoolSize() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.poolSize
+}
+
+// 本次运行的扩缩容记录
+func (ts *TaskScheduler) ScaleEvents() []ScaleEvent {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return append([]ScaleEvent(nil), ts.scaling...)
+}
+
+// 定期检查队列：积压或等待过久时成倍扩容，持续空闲时缩容到 MinWorkers
+func (ts *TaskScheduler) autoscaler(ctx context.Context, queue *readyQueue, clock Clock, opts AutoscaleOptions) {
+	defer ts.workers.Done()
+
+	var idleSince time.Time
+	for {
+		timer := clock.NewTimer(opts.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-queue.done:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		if queue.isClosed() {
+			return
+		}
+
+		depth, oldest := queue.stats()
+		now := clock.Now()
+		var wait time.Duration
+		if !oldest.IsZero() {
+			wait = now.Sub(oldest)
+		}
+
+		ts.mu.Lock()
+		size, busy := ts.poolSize, ts.busy
+		backlog := depth > size*opts.QueueDepth
+		slow := opts.QueueWait > 0 && wait >= opts.QueueWait
+		switch {
+		case depth > 0 && size < opts.MaxWorkers && (backlog || slow):
+			idleSince = time.Time{}
+			add := min(opts.MaxWorkers-size, max(size, 1), depth)
+			reason := "队列积压"
+			if !backlog {
+				reason = "等待过久"
+			}
+			ts.spawnWorkersLocked(ctx, add)
+			ts.recordScaleLocked(ScaleEvent{Time: now, From: size, To: size + add, Reason: reason, QueueDepth: depth, QueueWait: wait})
+
+		case depth == 0 && busy < size && size > opts.MinWorkers:
+			if idleSince.IsZero() {
+				idleSince = now
+			} else if now.Sub(idleSince) >= opts.IdleTimeout {
+				idleSince = time.Time{}
+				to := max(busy, opts.MinWorkers)
+				ts.poolSize = to
+				queue.retireWorkers(size - to)
+				ts.recordScaleLocked(ScaleEvent{Time: now, From: size, To: to, Reason: "空闲"})
+			}
+
+		default:
+			idleSince = time.Time{}
+		}
+		ts.mu.Unlock()
+	}
+}
+
+func (ts *TaskScheduler) recordScaleLocked(event ScaleEvent) {
+	ts.scaling = append(ts.scaling, event)
+	ts.logf("   [扩缩容] worker %d -> %d（%s，队列 %d 个任务，最久等待 %v）\n",
+		event.From, event.To, event.Reason, event.QueueDepth, event.QueueWait.Round(time.Millisecond))
+}
+
+func demoAutoscale() {
+	fmt.Println("演示14：自动扩缩容")
+
+	scheduler := NewTaskScheduler(16)
+	scheduler.SetAutoscale(AutoscaleOptions{
+		MinWorkers:  2,
+		MaxWorkers:  16,
+		QueueWait:   100 * time.Millisecond,
+		IdleTimeout: 300 * time.Millisecond,
+	})
+	scheduler.Start()
+
+	// 两波突发流量，中间空闲一段时间
+	for wave := 1; wave <= 2; wave++ {
+		var taskIDs []int
+		for i := 0; i < 40; i++ {
+			name := fmt.Sprintf("第%d波-%d", wave, i+1)
+			taskID, _ := scheduler.Submit(func(ctx context.Context) error {
+				sleepContext(ctx, 50*time.Millisecond)
+				return ctx.Err()
+			}, TaskOptions{Name: name})
+			taskIDs = append(taskIDs, taskID)
+		}
+		for _, taskID := range taskIDs {
+			scheduler.Wait(taskID)
+		}
+		fmt.Printf("第 %d 波完成，当前 worker 数: %d\n", wave, scheduler.PoolSize())
+		time.Sleep(500 * time.Millisecond)
+		fmt.Printf("空闲后 worker 数: %d\n", scheduler.PoolSize())
+	}
+	scheduler.Drain()
+	fmt.Printf("共 %d 次扩缩容\n\n", len(scheduler.ScaleEvents()))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAutoscalerFollowsSchedulerClock(t *testing.T) {
+	origin := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(origin)
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetQuiet(true)
+	scheduler.SetClock(clock)
+	scheduler.SetAutoscale(AutoscaleOptions{MinWorkers: 1, MaxWorkers: 4, Interval: time.Minute})
+	scheduler.Start()
+
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		scheduler.Submit(func(ctx context.Context) error {
+			<-release
+			return nil
+		}, TaskOptions{})
+	}
+
+	// 虚拟时间没有前进时不会扩容
+	clock.BlockUntil(1)
+	if got := scheduler.PoolSize(); got != 1 {
+		t.Fatalf("检查间隔还没到就扩容到了 %d 个 worker", got)
+	}
+
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+	events := scheduler.ScaleEvents()
+	if len(events) != 1 || events[0].To != 2 {
+		t.Fatalf("到检查时间后的扩缩容记录为 %+v，应从 1 扩容到 2", events)
+	}
+	if !events[0].Time.Equal(origin.Add(time.Minute)) {
+		t.Errorf("扩容时间为 %v，应为虚拟时间 %v", events[0].Time, origin.Add(time.Minute))
+	}
+
+	close(release)
+	scheduler.Drain()
+}
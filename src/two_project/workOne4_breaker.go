@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("熔断器已打开")
+
+// 熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行
+	BreakerOpen                         // 直接拒绝
+	BreakerHalfOpen                     // 放行少量探测任务
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "关闭"
+	case BreakerOpen:
+		return "打开"
+	case BreakerHalfOpen:
+		return "半开"
+	default:
+		return "未知"
+	}
+}
+
+// 熔断参数，零值字段使用默认值
+type BreakerOptions struct {
+	FailureRate float64       // 最近的尝试中失败比例达到该值时打开，默认 0.5
+	MinRequests int           // 统计窗口内至少有这么多次尝试才会打开，默认 5
+	Window      int           // 统计最近多少次尝试，默认 20
+	Cooldown    time.Duration // 打开后经过多久进入半开，默认 5s
+	Probes      int           // 半开时放行的探测任务数，全部成功后关闭，默认 1
+}
+
+func (o BreakerOptions) withDefaults() BreakerOptions {
+	if o.FailureRate <= 0 {
+		o.FailureRate = 0.5
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = 5
+	}
+	if o.Window <= 0 {
+		o.Window = 20
+	}
+	o.Window = max(o.Window, o.MinRequests)
+	if o.Cooldown <= 0 {
+		o.Cooldown = 5 * time.Second
+	}
+	if o.Probes <= 0 {
+		o.Probes = 1
+	}
+	return o
+}
+
+// 熔断器状态变化
+type BreakerTransition struct {
+	Group       string
+	From        BreakerState
+	To          BreakerState
+	Time        time.Time
+	TaskID      int     // 触发变化的任务
+	FailureRate float64 // 打开时窗口内的失败比例
+}
+
+// 单个分组的熔断器
+type breaker struct {
+	opts     BreakerOptions
+	state    BreakerState
+	outcomes []bool // 最近的尝试结果，true 表示失败
+	openedAt time.Time
+	probes   int // 半开状态下已放行的探测数
+	passed   int // 半开状态下已成功的探测数
+}
+
+func (b *breaker) failureRate() float64 {
+	failures := 0
+	for _, failed := range b.outcomes {
+		if failed {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(b.outcomes))
+}
+
+// 所有分组的熔断器
+type breakerSet struct {
+	mu          sync.Mutex
+	breakers    map[string]*breaker
+	transitions []BreakerTransition
+}
+
+func newBreakerSet() *breakerSet {
+	return &breakerSet{breakers: make(map[string]*breaker)}
+}
+
+// 为分组设置熔断器
+func (ts *TaskScheduler) SetBreaker(group string, opts BreakerOptions) {
+	ts.breakers.mu.Lock()
+	defer ts.breakers.mu.Unlock()
+
+	ts.breakers.breakers[group] = &breaker{opts: opts.withDefaults()}
+}
+
+// 分组熔断器的当前状态，没有设置熔断器时为关闭
+func (ts *TaskScheduler) BreakerState(group string) BreakerState {
+	ts.breakers.mu.Lock()
+	defer ts.breakers.mu.Unlock()
+
+	if b, ok := ts.breakers.breakers[group]; ok {
+		return b.state
+	}
+	return BreakerClosed
+}
+
+func (s *breakerSet) transitionLocked(b *breaker, group string, to BreakerState, now time.Time, taskID int) BreakerTransition {
+	t := BreakerTransition{Group: group, From: b.state, To: to, Time: now, TaskID: taskID}
+	if to == BreakerOpen && len(b.outcomes) > 0 {
+		t.FailureRate = b.failureRate()
+	}
+
+	b.state = to
+	switch to {
+	case BreakerOpen:
+		b.openedAt = now
+	case BreakerHalfOpen:
+		b.probes = 0
+		b.passed = 0
+	case BreakerClosed:
+		b.outcomes = nil
+	}
+	s.transitions = append(s.transitions, t)
+	return t
+}
+
+// 判断分组是否放行一次尝试，probe 表示这次尝试是半开状态下的探测
+func (s *breakerSet) allow(group string, taskID int, now time.Time) (ok, probe bool, transitions []BreakerTransition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, exists := s.breakers[group]
+	if !exists {
+		return true, false, nil
+	}
+
+	if b.state == BreakerOpen {
+		if now.Sub(b.openedAt) < b.opts.Cooldown {
+			return false, false, nil
+		}
+		transitions = append(transitions, s.transitionLocked(b, group, BreakerHalfOpen, now, taskID))
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.opts.Probes {
+			return false, false, transitions
+		}
+		b.probes++
+		return true, true, transitions
+	}
+	return true, false, transitions
+}
+
+// 记录一次尝试的结果，取消的尝试不计入
+func (s *breakerSet) record(group string, taskID int, probe bool, status TaskStatus, now time.Time) []BreakerTransition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, exists := s.breakers[group]
+	if !exists {
+		return nil
+	}
+
+	failed := status != StatusSuccess
+	if status == StatusCancelled {
+		if probe && b.state == BreakerHalfOpen {
+			b.probes--
+		}
+		return nil
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		b.outcomes = append(b.outcomes, failed)
+		if len(b.outcomes) > b.opts.Window {
+			b.outcomes = b.outcomes[len(b.outcomes)-b.opts.Window:]
+		}
+		if len(b.outcomes) >= b.opts.MinRequests && b.failureRate() >= b.opts.FailureRate {
+			return []BreakerTransition{s.transitionLocked(b, group, BreakerOpen, now, taskID)}
+		}
+
+	case BreakerHalfOpen:
+		// 打开前已经开始的尝试不影响探测结果
+		if !probe {
+			return nil
+		}
+		if failed {
+			return []BreakerTransition{s.transitionLocked(b, group, BreakerOpen, now, taskID)}
+		}
+		b.passed++
+		if b.passed >= b.opts.Probes {
+			return []BreakerTransition{s.transitionLocked(b, group, BreakerClosed, now, taskID)}
+		}
+	}
+	return nil
+}
+
+// 本次运行的全部状态变化
+func (s *breakerSet) history() []BreakerTransition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]BreakerTransition(nil), s.transitions...)
+}
+
+func (s *breakerSet) resetHistory() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transitions = nil
+}
+
+// 经过熔断器执行一次尝试
+func (ts *TaskScheduler) guardedAttempt(ctx context.Context, attempt int, taskID int, entry *taskEntry, result *TaskResult) AttemptResult {
+	if entry.group == "" {
+		return ts.executeAttempt(ctx, attempt, entry.fn)
+	}
+
+	ok, probe, transitions := ts.breakers.allow(entry.group, taskID, ts.clock.Now())
+	ts.logTransitions(transitions)
+	result.BreakerTransitions = append(result.BreakerTransitions, transitions...)
+	if !ok {
+		now := ts.clock.Now()
+		return AttemptResult{
+			Attempt:   attempt,
+			StartTime: now,
+			EndTime:   now,
+			Error:     fmt.Errorf("%w: %s", ErrCircuitOpen, entry.group),
+			Status:    StatusRejected,
+		}
+	}
+
+	a := ts.executeAttempt(ctx, attempt, entry.fn)
+	transitions = ts.breakers.record(entry.group, taskID, probe, a.Status, ts.clock.Now())
+	ts.logTransitions(transitions)
+	result.BreakerTransitions = append(result.BreakerTransitions, transitions...)
+	return a
+}
+
+func (ts *TaskScheduler) logTransitions(transitions []BreakerTransition) {
+	for _, t := range transitions {
+		if t.To == BreakerOpen {
+			ts.logf("   [熔断] 分组 %s: %s -> %s（失败率 %.0f%%）\n", t.Group, t.From, t.To, t.FailureRate*100)
+		} else {
+			ts.logf("   [熔断] 分组 %s: %s -> %s\n", t.Group, t.From, t.To)
+		}
+	}
+}
+
+func demoCircuitBreaker() {
+	fmt.Println("演示20：分组熔断")
+
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetBreaker("payment", BreakerOptions{MinRequests: 3, FailureRate: 0.5, Cooldown: 300 * time.Millisecond})
+	scheduler.Start()
+
+	// 支付服务先不可用，每次调用都要等 100ms 才失败
+	var down atomic.Bool
+	down.Store(true)
+	pay := func(ctx context.Context) error {
+		if !sleepContext(ctx, 100*time.Millisecond) {
+			return ctx.Err()
+		}
+		if down.Load() {
+			return errors.New("支付服务不可用")
+		}
+		return nil
+	}
+
+	submit := func(from, to int) {
+		var taskIDs []int
+		for i := from; i <= to; i++ {
+			taskID, _ := scheduler.Submit(pay, TaskOptions{Name: fmt.Sprintf("支付%d", i), Group: "payment"})
+			taskIDs = append(taskIDs, taskID)
+		}
+		for _, taskID := range taskIDs {
+			scheduler.Wait(taskID)
+		}
+	}
+
+	submit(1, 8)
+	fmt.Println("支付服务恢复")
+	down.Store(false)
+	time.Sleep(300 * time.Millisecond)
+	// 冷却结束后第一个任务作为探测，成功后熔断器关闭
+	submit(9, 9)
+	submit(10, 12)
+
+	scheduler.Drain()
+	scheduler.ReportSummary()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerStateTransitions(t *testing.T) {
+	s := newBreakerSet()
+	s.breakers["api"] = &breaker{opts: BreakerOptions{MinRequests: 4, Cooldown: 10 * time.Second, Probes: 2}.withDefaults()}
+	b := s.breakers["api"]
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 尝试次数不足 MinRequests 时不打开
+	s.record("api", 0, false, StatusSuccess, now)
+	for i := 1; i <= 2; i++ {
+		if transitions := s.record("api", i, false, StatusFailed, now); len(transitions) != 0 || b.state != BreakerClosed {
+			t.Fatalf("第 %d 次失败后状态为 %s", i, b.state)
+		}
+	}
+	transitions := s.record("api", 3, false, StatusTimeout, now)
+	if len(transitions) != 1 || transitions[0].To != BreakerOpen || transitions[0].FailureRate != 0.75 || transitions[0].TaskID != 3 {
+		t.Fatalf("失败率 75%% 时的状态变化为 %+v，应打开", transitions)
+	}
+
+	// 冷却期间拒绝，之后进入半开并只放行 Probes 个探测
+	if ok, _, _ := s.allow("api", 4, now.Add(9*time.Second)); ok {
+		t.Fatal("冷却期间应拒绝")
+	}
+	now = now.Add(10 * time.Second)
+	ok, probe, transitions := s.allow("api", 5, now)
+	if !ok || !probe || len(transitions) != 1 || transitions[0].To != BreakerHalfOpen {
+		t.Fatalf("冷却后 ok=%v probe=%v，状态变化 %+v，应进入半开并放行探测", ok, probe, transitions)
+	}
+	if ok, probe, _ := s.allow("api", 6, now); !ok || !probe {
+		t.Fatal("半开时应放行第 2 个探测")
+	}
+	if ok, _, _ := s.allow("api", 7, now); ok {
+		t.Fatal("探测数已满时应拒绝")
+	}
+
+	// 取消的探测归还名额；探测失败时重新打开
+	s.record("api", 6, true, StatusCancelled, now)
+	if ok, _, _ := s.allow("api", 8, now); !ok {
+		t.Fatal("取消的探测应归还名额")
+	}
+	s.record("api", 5, true, StatusSuccess, now)
+	if transitions := s.record("api", 8, true, StatusFailed, now); len(transitions) != 1 || transitions[0].To != BreakerOpen {
+		t.Fatalf("探测失败后的状态变化为 %+v，应重新打开", transitions)
+	}
+
+	// 再次冷却后全部探测成功则关闭，之前的失败记录被清空
+	now = now.Add(10 * time.Second)
+	s.allow("api", 9, now)
+	s.allow("api", 10, now)
+	s.record("api", 9, true, StatusSuccess, now)
+	transitions = s.record("api", 10, true, StatusSuccess, now)
+	if len(transitions) != 1 || transitions[0].From != BreakerHalfOpen || transitions[0].To != BreakerClosed || len(b.outcomes) != 0 {
+		t.Fatalf("探测全部成功后的状态变化为 %+v，记录 %v", transitions, b.outcomes)
+	}
+	if got := len(s.history()); got != 5 {
+		t.Errorf("共有 %d 次状态变化，应为 5", got)
+	}
+}
+
+func TestBreakerRejectsTasksWhileOpen(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetSimulation(NewSimulation(1))
+	scheduler.SetBreaker("api", BreakerOptions{MinRequests: 2, Cooldown: time.Minute})
+
+	fail := func(ctx context.Context) error { return errors.New("接口出错") }
+	scheduler.AddTaskWithOptions(fail, TaskOptions{Group: "api"})
+	scheduler.AddTaskWithOptions(fail, TaskOptions{Group: "api"})
+	rejected, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+		t.Error("熔断器打开时任务不应执行")
+		return nil
+	}, TaskOptions{Group: "api"})
+	// 其他分组不受影响，它执行期间冷却结束
+	scheduler.AddTaskWithOptions(func(ctx context.Context) error { return Sleep(ctx, 2*time.Minute) }, TaskOptions{})
+	probe, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error { return nil }, TaskOptions{Group: "api"})
+	runSimulated(t, scheduler, 5*time.Second)
+
+	results := scheduler.GetResults()
+	if r := results[rejected]; r.Status != StatusRejected || r.Started || !errors.Is(r.Error, ErrCircuitOpen) {
+		t.Errorf("熔断时的任务状态为 %s，错误为 %v", r.Status, r.Error)
+	}
+	if r := results[probe]; r.Status != StatusSuccess {
+		t.Errorf("冷却后的探测任务状态为 %s，应为成功", r.Status)
+	}
+	if state := scheduler.BreakerState("api"); state != BreakerClosed {
+		t.Errorf("探测成功后熔断器为 %s，应为关闭", state)
+	}
+
+	summary := scheduler.Summary()
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if summary.Rejected != 1 || len(summary.BreakerTransitions) != len(want) {
+		t.Fatalf("摘要中熔断 %d 个，状态变化 %+v", summary.Rejected, summary.BreakerTransitions)
+	}
+	for i, tr := range summary.BreakerTransitions {
+		if tr.To != want[i] {
+			t.Errorf("第 %d 次状态变化到 %s，应为 %s", i+1, tr.To, want[i])
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 周期调度规则
+type Schedule interface {
+	// 返回严格晚于 t 的下一次执行时间，没有则返回零值
+	Next(t time.Time) time.Time
+}
+
+// 固定间隔执行
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func Every(interval time.Duration) Schedule {
+	return intervalSchedule{interval: interval}
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// 标准 5 字段 cron 表达式：分 时 日 月 周
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // 每个字段允许的取值（按位）
+	domStar, dowStar              bool   // 日、周字段是否以 * 开头（如 * 或 */2）
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMinute = cronField{0, 59, nil}
+	cronHour   = cronField{0, 23, nil}
+	cronDom    = cronField{1, 31, nil}
+	cronMonth  = cronField{1, 12, map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	// 周日可以写成 0 或 7
+	cronDow = cronField{0, 7, map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+)
+
+var (
+	ErrInvalidCron     = errors.New("无效的 cron 表达式")
+	ErrInvalidInterval = errors.New("周期任务的间隔必须大于 0")
+)
+
+// 解析 cron 表达式，支持 *、列表(1,2)、范围(1-5)、步长(*/15) 以及月份和星期的英文缩写
+func ParseCron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q 需要 5 个字段", ErrInvalidCron, expr)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = cronMinute.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = cronHour.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = cronDom.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = cronMonth.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = cronDow.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	// 与 Vixie cron 一致，以 * 开头的字段（包括 */2）都视为不限制，日和周按 AND 组合
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// 解析单个字段，返回允许取值的位图
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%w: 步长 %q", ErrInvalidCron, part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			// 单个值带步长时表示从该值到最大值
+			lo, hi = v, v
+			if step > 1 {
+				hi = f.max
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("%w: 范围 %q", ErrInvalidCron, part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%w: 取值 %q 超出 %d-%d", ErrInvalidCron, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// 从下一分钟开始查找
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// 日和周都有限制时满足其一即可，与标准 cron 一致
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// 错过执行时间后的处理策略
+type MissedRunPolicy int
+
+const (
+	MissedSkip        MissedRunPolicy = iota // 丢弃错过的执行，等待下一个时间点
+	MissedCatchUpOnce                        // 错过的执行合并为一次，尽快补跑
+)
+
+// 周期任务选项
+type RecurringOptions struct {
+	Name   string
+	Missed MissedRunPolicy
+	// 允许的延迟，超过该时间才算错过，默认 1 秒
+	Tolerance time.Duration
+	// 每次运行提交任务时使用的选项，Name 会被自动填写
+	Task TaskOptions
+}
+
+// 周期任务
+type RecurringJob struct {
+	ts       *TaskScheduler
+	schedule Schedule
+	task     ContextTask
+	opts     RecurringOptions
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	mu     sync.Mutex
+	runs   []int // 每次运行提交的任务ID
+	missed int   // 累计错过的次数
+	next   time.Time
+}
+
+// 添加周期任务，调度器需要已经以服务模式启动
+// 上一次运行还没结束时不会重复提交，这一次算作错过
+func (ts *TaskScheduler) AddRecurring(schedule Schedule, task ContextTask, opts RecurringOptions) (*RecurringJob, error) {
+	if s, ok := schedule.(intervalSchedule); ok && s.interval <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInterval, s.interval)
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = time.Second
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if !ts.accepting {
+		return nil, ErrSchedulerStopped
+	}
+
+	job := &RecurringJob{
+		ts:       ts,
+		schedule: schedule,
+		task:     task,
+		opts:     opts,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	ts.recurring = append(ts.recurring, job)
+	go job.loop(ts.clock)
+	return job, nil
+}
+
+// 停止所有周期任务
+func (ts *TaskScheduler) stopRecurring() {
+	ts.mu.Lock()
+	jobs := ts.recurring
+	ts.recurring = nil
+	ts.mu.Unlock()
+
+	for _, job := range jobs {
+		job.Stop()
+	}
+}
+
+// 停止周期任务，已经提交的任务不受影响
+func (j *RecurringJob) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+	})
+	<-j.done
+}
+
+// 已提交的任务ID
+func (j *RecurringJob) Runs() []int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]int(nil), j.runs...)
+}
+
+// 累计错过的次数
+func (j *RecurringJob) Missed() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.missed
+}
+
+// 下一次计划执行的时间
+func (j *RecurringJob) Next() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.next
+}
+
+func (j *RecurringJob) loop(clock Clock) {
+	defer close(j.done)
+
+	next := j.schedule.Next(clock.Now())
+	catchUp := false // 有错过的执行等待补跑
+
+	for !next.IsZero() {
+		j.mu.Lock()
+		j.next = next
+		j.mu.Unlock()
+
+		// 等待补跑时，上一次运行结束后立即补跑
+		var idle <-chan struct{}
+		if catchUp {
+			idle = j.lastDone()
+		}
+
+		timer := clock.NewTimer(next.Sub(clock.Now()))
+		select {
+		case <-j.stop:
+			timer.Stop()
+			return
+		case <-idle:
+			timer.Stop()
+			catchUp = false
+			if !j.fire(true) {
+				return
+			}
+			continue
+		case <-timer.C():
+		}
+
+		// 找出所有已经到期的时间点，只有最后一个可能是准时的
+		now := clock.Now()
+		var latest time.Time
+		due := 0
+		for !next.IsZero() && !next.After(now) {
+			latest = next
+			due++
+			// 自定义规则返回的时间没有往后推进时停止调度，避免死循环
+			following := j.schedule.Next(next)
+			if !following.IsZero() && !following.After(next) {
+				j.ts.logf("   周期任务 %s 的下一次执行时间 %s 没有晚于 %s，停止调度\n",
+					j.opts.Name, following.Format(time.RFC3339), next.Format(time.RFC3339))
+				following = time.Time{}
+			}
+			next = following
+		}
+		if due == 0 {
+			continue
+		}
+
+		onTime := now.Sub(latest) <= j.opts.Tolerance
+		busy := j.busy()
+		missed := due
+		if onTime && !busy {
+			missed--
+			if !j.fire(false) {
+				return
+			}
+		}
+		if missed == 0 {
+			continue
+		}
+
+		j.mu.Lock()
+		j.missed += missed
+		j.mu.Unlock()
+		j.ts.logf("   周期任务 %s 错过 %d 次执行\n", j.opts.Name, missed)
+
+		// 本轮已经准时运行过则无需再补跑
+		if j.opts.Missed == MissedCatchUpOnce && !(onTime && !busy) {
+			if busy {
+				catchUp = true
+			} else if !j.fire(true) {
+				return
+			}
+		}
+	}
+}
+
+// 上一次运行是否还没结束
+func (j *RecurringJob) busy() bool {
+	select {
+	case <-j.lastDone():
+		return false
+	default:
+		return true
+	}
+}
+
+// 上一次运行结束时关闭的通道，没有运行过时返回已关闭的通道
+func (j *RecurringJob) lastDone() <-chan struct{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.runs) > 0 {
+		ts := j.ts
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		// 已被清理的任务早已结束
+		if entry, err := ts.lookupLocked(j.runs[len(j.runs)-1]); err == nil {
+			return entry.done
+		}
+	}
+
+	closed := make(chan struct{})
+	close(closed)
+	return closed
+}
+
+// 提交一次运行，调度器停止后返回 false
+func (j *RecurringJob) fire(catchUp bool) bool {
+	j.mu.Lock()
+	n := len(j.runs) + 1
+	j.mu.Unlock()
+
+	opts := j.opts.Task
+	opts.Name = fmt.Sprintf("%s#%d", j.opts.Name, n)
+	if catchUp {
+		opts.Name += "(补跑)"
+	}
+
+	taskID, err := j.ts.Submit(j.task, opts)
+	if err != nil {
+		return false
+	}
+
+	j.mu.Lock()
+	j.runs = append(j.runs, taskID)
+	j.mu.Unlock()
+	return true
+}
+
+func demoRecurring() {
+	fmt.Println("演示9：周期任务")
+
+	// 使用真实时钟：每 150ms 清理一次
+	scheduler := NewTaskScheduler(2)
+	scheduler.Start()
+	cleanup, _ := scheduler.AddRecurring(Every(150*time.Millisecond), func(ctx context.Context) error {
+		fmt.Println("   清理临时文件")
+		return nil
+	}, RecurringOptions{Name: "清理"})
+	time.Sleep(500 * time.Millisecond)
+	scheduler.Drain()
+	fmt.Printf("清理任务共运行 %d 次\n", len(cleanup.Runs()))
+
+	// 使用手动时钟：不需要真实等待就能验证调度规则
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	clock := NewFakeClock(start)
+	scheduler = NewTaskScheduler(2)
+	scheduler.SetClock(clock)
+	scheduler.Start()
+
+	every5, _ := ParseCron("*/5 * * * *")
+	noop := func(ctx context.Context) error { return nil }
+	report, _ := scheduler.AddRecurring(every5, noop, RecurringOptions{Name: "报表", Missed: MissedSkip})
+	backup, _ := scheduler.AddRecurring(Every(5*time.Minute), noop, RecurringOptions{Name: "备份", Missed: MissedCatchUpOnce})
+
+	// 等两个周期任务都进入等待后再推进时间
+	// 并等上一次运行结束，避免被当成错过
+	step := func(d time.Duration) {
+		clock.BlockUntil(2)
+		for _, job := range []*RecurringJob{report, backup} {
+			if runs := job.Runs(); len(runs) > 0 {
+				scheduler.Wait(runs[len(runs)-1])
+			}
+		}
+		clock.Advance(d)
+	}
+	for i := 0; i < 3; i++ {
+		step(5 * time.Minute)
+	}
+	// 模拟进程卡顿：一次跳过 20 分半，错过多个时间点
+	step(20*time.Minute + 30*time.Second)
+	clock.BlockUntil(2)
+
+	scheduler.Drain()
+	fmt.Printf("报表(跳过策略): 运行 %d 次，错过 %d 次\n", len(report.Runs()), report.Missed())
+	fmt.Printf("备份(补跑一次): 运行 %d 次，错过 %d 次\n", len(backup.Runs()), backup.Missed())
+	fmt.Println()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 总是返回同一个时间点的规则，到期后 Next 不再往后推进
+type stuckSchedule struct {
+	at time.Time
+}
+
+func (s stuckSchedule) Next(t time.Time) time.Time {
+	return s.at
+}
+
+func TestRecurringRejectsNonPositiveInterval(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	noop := func(ctx context.Context) error { return nil }
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := scheduler.AddRecurring(Every(interval), noop, RecurringOptions{}); !errors.Is(err, ErrInvalidInterval) {
+			t.Errorf("间隔 %v 返回 %v，应为 ErrInvalidInterval", interval, err)
+		}
+	}
+}
+
+func TestRecurringStopsWhenScheduleDoesNotAdvance(t *testing.T) {
+	origin := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(origin)
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetClock(clock)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	job, err := scheduler.AddRecurring(stuckSchedule{at: origin.Add(time.Minute)}, func(ctx context.Context) error {
+		return nil
+	}, RecurringOptions{Name: "卡住"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+
+	select {
+	case <-job.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("下一次执行时间没有推进时周期任务没有停止")
+	}
+	if got := len(job.Runs()); got != 1 {
+		t.Errorf("周期任务运行了 %d 次，应为 1", got)
+	}
+}
+
+func TestCronStepDayFieldsUseAndSemantics(t *testing.T) {
+	// 单数日且是周一；2024-01-01 是周一，下一次应是 2024-01-15 而不是 2024-01-03
+	sched, err := ParseCron("0 0 */2 * MON")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	if got := sched.Next(from); !got.Equal(want) {
+		t.Errorf("下一次执行为 %v，应为 %v", got, want)
+	}
+
+	// 日和周都有具体限制时仍按 OR 组合：1 号或周三
+	sched, err = ParseCron("0 0 1 * WED")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	if got := sched.Next(from); !got.Equal(want) {
+		t.Errorf("下一次执行为 %v，应为 %v", got, want)
+	}
+}
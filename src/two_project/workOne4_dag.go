@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrUnknownTask     = errors.New("任务不存在")
+	ErrDependencyCycle = errors.New("任务依赖存在环")
+	ErrUpstreamFailed  = errors.New("上游任务失败")
+)
+
+// 添加依赖关系：taskID 需要等 dependsOn 成功后才能执行
+// 如果新依赖会形成环则直接拒绝
+func (ts *TaskScheduler) AddDependency(taskID, dependsOn int) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, id := range []int{taskID, dependsOn} {
+		if _, err := ts.lookupLocked(id); err != nil {
+			return err
+		}
+	}
+
+	if taskID == dependsOn || ts.dependsOn(dependsOn, taskID) {
+		return fmt.Errorf("%w: 任务 %d -> 任务 %d", ErrDependencyCycle, taskID+1, dependsOn+1)
+	}
+
+	entry := ts.entryLocked(taskID)
+	for _, dep := range entry.deps {
+		if dep == dependsOn {
+			return nil
+		}
+	}
+	entry.deps = append(entry.deps, dependsOn)
+	return nil
+}
+
+// 判断 from 是否直接或间接依赖 target
+func (ts *TaskScheduler) dependsOn(from, target int) bool {
+	visited := make(map[int]bool)
+	stack := []int{from}
+
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == target {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		if entry := ts.entryLocked(id); entry != nil {
+			stack = append(stack, entry.deps...)
+		}
+	}
+	return false
+}
+
+// 计算拓扑顺序，同一层按任务ID排序，存在环时返回错误
+// 下标均为 任务ID-ts.base，已被清理的任务不参与排序
+func (ts *TaskScheduler) topoOrder() ([]int, error) {
+	pending := make([]int, len(ts.tasks))
+	dependents := make([][]int, len(ts.tasks))
+	var queue []int
+	count := 0
+
+	for i, entry := range ts.tasks {
+		if entry == nil {
+			continue
+		}
+		count++
+		for _, dep := range entry.deps {
+			if ts.entryLocked(dep) == nil {
+				continue
+			}
+			pending[i]++
+			dependents[dep-ts.base] = append(dependents[dep-ts.base], i)
+		}
+		if pending[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+
+	order := make([]int, 0, count)
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		order = append(order, ts.base+i)
+
+		for _, next := range dependents[i] {
+			pending[next]--
+			if pending[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if len(order) != count {
+		return nil, ErrDependencyCycle
+	}
+	return order, nil
+}
+
+// 生成因上游失败而跳过的任务结果，错误指向最初失败的任务
+func (ts *TaskScheduler) skippedResult(taskID int, upstream TaskResult) TaskResult {
+	err := upstream.Error
+	if upstream.Status != StatusSkipped {
+		err = fmt.Errorf("%w: 任务 %d", ErrUpstreamFailed, upstream.TaskID+1)
+	}
+
+	now := ts.clock.Now()
+	entry := ts.entryLocked(taskID)
+	return TaskResult{
+		TaskID:    taskID,
+		Name:      entry.name,
+		Group:     entry.group,
+		Tenant:    entry.tenant,
+		StartTime: now,
+		EndTime:   now,
+		Error:     err,
+		Status:    StatusSkipped,
+	}
+}
+
+// 模拟一个耗时步骤
+func sleepStep(name string, d time.Duration, err error) ContextTask {
+	return func(ctx context.Context) error {
+		if err := Sleep(ctx, d); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("   %s 完成\n", name)
+		return nil
+	}
+}
+
+func demoDependencyGraph() {
+	fmt.Println("演示5：按依赖关系执行任务")
+
+	scheduler := NewTaskScheduler(3)
+
+	// 两条流水线：抓取 -> 转换 -> 加载，第二条的抓取会失败
+	fetchA, _ := scheduler.AddTaskWithOptions(sleepStep("抓取A", 200*time.Millisecond, nil), TaskOptions{Name: "抓取A"})
+	fetchB, _ := scheduler.AddTaskWithOptions(sleepStep("抓取B", 100*time.Millisecond, errors.New("连接被拒绝")), TaskOptions{Name: "抓取B"})
+	transformA, _ := scheduler.AddTaskWithOptions(sleepStep("转换A", 200*time.Millisecond, nil), TaskOptions{Name: "转换A", DependsOn: []int{fetchA}})
+	transformB, _ := scheduler.AddTaskWithOptions(sleepStep("转换B", 200*time.Millisecond, nil), TaskOptions{Name: "转换B", DependsOn: []int{fetchB}})
+	scheduler.AddTaskWithOptions(sleepStep("加载A", 100*time.Millisecond, nil), TaskOptions{Name: "加载A", DependsOn: []int{transformA}})
+	scheduler.AddTaskWithOptions(sleepStep("加载B", 100*time.Millisecond, nil), TaskOptions{Name: "加载B", DependsOn: []int{transformB}})
+
+	// 环形依赖会被拒绝
+	if err := scheduler.AddDependency(fetchA, transformA); err != nil {
+		fmt.Printf("添加依赖失败: %v\n", err)
+	}
+
+	scheduler.RunParallel()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDAGSkipsDownstreamOfFailedTask(t *testing.T) {
+	runs := map[string]func(*TaskScheduler){
+		"串行": (*TaskScheduler).RunSerial,
+		"并行": (*TaskScheduler).RunParallel,
+	}
+	for mode, run := range runs {
+		scheduler := NewTaskScheduler(2)
+		scheduler.SetQuiet(true)
+		fail, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+			return errors.New("下载失败")
+		}, TaskOptions{Name: "下载"})
+		parse, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+			t.Errorf("%s: 上游失败后下游任务不应执行", mode)
+			return nil
+		}, TaskOptions{Name: "解析", DependsOn: []int{fail}})
+		report, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+			t.Errorf("%s: 间接依赖失败任务的任务不应执行", mode)
+			return nil
+		}, TaskOptions{Name: "报告", DependsOn: []int{parse}})
+		other, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error { return nil }, TaskOptions{Name: "其他"})
+		after, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error { return nil }, TaskOptions{DependsOn: []int{other}})
+		run(scheduler)
+
+		results := scheduler.GetResults()
+		if results[fail].Status != StatusFailed {
+			t.Errorf("%s: 失败任务状态为 %s", mode, results[fail].Status)
+		}
+		// 直接和间接的下游都被跳过，错误都指向最初失败的任务 1
+		for _, id := range []int{parse, report} {
+			r := results[id]
+			if r.Status != StatusSkipped || r.Started || !errors.Is(r.Error, ErrUpstreamFailed) || !strings.HasSuffix(r.Error.Error(), "任务 1") {
+				t.Errorf("%s: 任务 %d 状态为 %s，错误为 %v，应因任务 1 失败而跳过", mode, id+1, r.Status, r.Error)
+			}
+		}
+		for _, id := range []int{other, after} {
+			if results[id].Status != StatusSuccess {
+				t.Errorf("%s: 不相关的任务 %d 状态为 %s，应为成功", mode, id+1, results[id].Status)
+			}
+		}
+	}
+}
+
+func TestAddDependencyRejectsCycles(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	noop := func(ctx context.Context) error { return nil }
+	a, _ := scheduler.AddTaskWithOptions(noop, TaskOptions{})
+	b, _ := scheduler.AddTaskWithOptions(noop, TaskOptions{DependsOn: []int{a}})
+	c, _ := scheduler.AddTaskWithOptions(noop, TaskOptions{DependsOn: []int{b}})
+
+	for _, edge := range [][2]int{{a, a}, {a, b}, {a, c}} {
+		if err := scheduler.AddDependency(edge[0], edge[1]); !errors.Is(err, ErrDependencyCycle) {
+			t.Errorf("任务 %d 依赖任务 %d 返回 %v，应为 ErrDependencyCycle", edge[0]+1, edge[1]+1, err)
+		}
+	}
+	if err := scheduler.AddDependency(c, a); err != nil {
+		t.Errorf("不形成环的依赖返回 %v", err)
+	}
+	if err := scheduler.AddDependency(a, 99); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("依赖不存在的任务返回 %v，应为 ErrUnknownTask", err)
+	}
+	if _, err := scheduler.AddTaskWithOptions(noop, TaskOptions{DependsOn: []int{99}}); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("添加依赖不存在任务的任务返回 %v，应为 ErrUnknownTask", err)
+	}
+
+	// 被拒绝的依赖没有留下，所有任务都能执行
+	scheduler.RunParallel()
+	for _, r := range scheduler.GetResults() {
+		if r.Status != StatusSuccess {
+			t.Errorf("任务 %d 状态为 %s，应为成功", r.TaskID+1, r.Status)
+		}
+	}
+}
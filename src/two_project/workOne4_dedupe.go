@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrDuplicateTask = errors.New("相同幂等键的任务已存在")
+
+// 重复提交的处理方式
+type DedupePolicy int
+
+const (
+	DedupeReject   DedupePolicy = iota // 拒绝重复提交，返回已有任务的ID和 ErrDuplicateTask
+	DedupeCoalesce                     // 合并到已有任务，返回已有任务的ID，所有提交者拿到同一个结果
+)
+
+// 幂等键对应的任务
+type dedupeKey struct {
+	taskID int
+	future any // 用 Submit[T] 提交时的 Future，合并的提交共享它的返回值
+}
+
+// 已成功的幂等键的过期时间
+type keyExpiry struct {
+	key    string
+	taskID int
+	at     time.Time
+}
+
+// 设置重复提交的处理方式，retention 为成功结束的任务继续占用幂等键的时间
+// 失败、取消或跳过的任务结束后立即释放幂等键，可以重新提交
+func (ts *TaskScheduler) SetDedupe(policy DedupePolicy, retention time.Duration) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.dedupe = policy
+	ts.retention = retention
+}
+
+// 查找幂等键对应的任务，已过期的键会被清理
+func (ts *TaskScheduler) dedupeLocked(key string) (int, bool, error) {
+	if key == "" {
+		return -1, false, nil
+	}
+
+	now := ts.clock.Now()
+	for len(ts.expiry) > 0 && !now.Before(ts.expiry[0].at) {
+		ts.forgetKeyLocked(ts.expiry[0].key, ts.expiry[0].taskID)
+		ts.expiry = ts.expiry[1:]
+	}
+
+	k, ok := ts.keys[key]
+	if !ok {
+		return -1, false, nil
+	}
+	if ts.dedupe == DedupeReject {
+		return k.taskID, true, fmt.Errorf("%w: %s（任务 %d）", ErrDuplicateTask, key, k.taskID+1)
+	}
+	return k.taskID, true, nil
+}
+
+// 登记新任务的幂等键
+func (ts *TaskScheduler) registerKeyLocked(entry *taskEntry, taskID int) {
+	if entry.key == "" {
+		return
+	}
+	if ts.keys == nil {
+		ts.keys = make(map[string]*dedupeKey)
+	}
+	ts.keys[entry.key] = &dedupeKey{taskID: taskID}
+}
+
+// 任务结束后释放幂等键，成功的任务保留到 retention 之后
+func (ts *TaskScheduler) releaseKeyLocked(entry *taskEntry, result TaskResult) {
+	if entry.key == "" {
+		return
+	}
+	if result.Success && ts.retention > 0 {
+		ts.expiry = append(ts.expiry, keyExpiry{key: entry.key, taskID: result.TaskID, at: ts.clock.Now().Add(ts.retention)})
+		return
+	}
+	ts.forgetKeyLocked(entry.key, result.TaskID)
+}
+
+// 删除幂等键，键已经指向更新的任务时保留
+func (ts *TaskScheduler) forgetKeyLocked(key string, taskID int) {
+	if k, ok := ts.keys[key]; ok && k.taskID == taskID {
+		delete(ts.keys, key)
+	}
+}
+
+func demoDedupe() {
+	fmt.Println("演示21：幂等键去重")
+
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetDedupe(DedupeCoalesce, 200*time.Millisecond)
+	scheduler.Start()
+
+	var builds atomic.Int32
+	rebuild := func(ctx context.Context) (string, error) {
+		n := builds.Add(1)
+		sleepContext(ctx, 100*time.Millisecond)
+		return fmt.Sprintf("报表X 第 %d 版", n), nil
+	}
+
+	// 5 个客户端同时要求重建同一份报表，只执行一次
+	var wg sync.WaitGroup
+	for c := 1; c <= 5; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f := Submit(scheduler, rebuild, TaskOptions{Name: "重建报表X", Key: "report:X"})
+			v, _ := f.Await()
+			fmt.Printf("   客户端%d 收到: %s（任务 %d）\n", c, v, f.TaskID()+1)
+		}()
+	}
+	wg.Wait()
+
+	// 保留期内再次提交直接拿到上次的结果
+	v, _ := Submit(scheduler, rebuild, TaskOptions{Name: "重建报表X", Key: "report:X"}).Await()
+	fmt.Printf("保留期内提交: %s\n", v)
+
+	time.Sleep(250 * time.Millisecond)
+	v, _ = Submit(scheduler, rebuild, TaskOptions{Name: "重建报表X", Key: "report:X"}).Await()
+	fmt.Printf("保留期过后提交: %s，共执行 %d 次\n", v, builds.Load())
+	scheduler.Drain()
+
+	// 拒绝模式下，排队或运行中的重复提交直接返回错误
+	scheduler = NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.Start()
+	first, _ := scheduler.Submit(sleepStep("导出", 100*time.Millisecond, nil), TaskOptions{Name: "导出", Key: "export:1"})
+	second, err := scheduler.Submit(sleepStep("导出", 100*time.Millisecond, nil), TaskOptions{Name: "导出", Key: "export:1"})
+	scheduler.Drain()
+	fmt.Printf("第一次提交: 任务 %d，重复提交: 任务 %d，错误: %v\n\n", first+1, second+1, err)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupeReject(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetDedupe(DedupeReject, 0)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Drain()
+
+	release := make(chan struct{})
+	first, _ := scheduler.Submit(func(ctx context.Context) error {
+		<-release
+		return nil
+	}, TaskOptions{Key: "export"})
+
+	// 运行中的重复提交被拒绝，返回已有任务的ID
+	id, err := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{Key: "export"})
+	if id != first || !errors.Is(err, ErrDuplicateTask) {
+		t.Errorf("重复提交返回 %d %v，应为任务 %d 和 ErrDuplicateTask", id, err, first)
+	}
+	if _, err := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{Key: "other"}); err != nil {
+		t.Errorf("不同的幂等键被拒绝: %v", err)
+	}
+	close(release)
+	scheduler.Wait(first)
+
+	// 没有保留期时，成功结束后立即可以重新提交；失败的任务同样释放幂等键
+	failed, err := scheduler.Submit(func(ctx context.Context) error { return errors.New("失败") }, TaskOptions{Key: "export"})
+	if err != nil || failed == first {
+		t.Fatalf("结束后重新提交返回 %d %v", failed, err)
+	}
+	scheduler.Wait(failed)
+	if _, err := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{Key: "export"}); err != nil {
+		t.Errorf("失败后重新提交返回 %v", err)
+	}
+}
+
+func TestDedupeCoalesce(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetClock(clock)
+	scheduler.SetDedupe(DedupeCoalesce, time.Minute)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Drain()
+
+	var builds atomic.Int32
+	release := make(chan struct{})
+	build := func(ctx context.Context) (int32, error) {
+		n := builds.Add(1)
+		<-release
+		return n, nil
+	}
+
+	// 运行中的重复提交合并到同一个任务，拿到同一个结果
+	futures := make([]*Future[int32], 3)
+	for i := range futures {
+		futures[i] = Submit(scheduler, build, TaskOptions{Key: "report"})
+	}
+	close(release)
+	for i, f := range futures {
+		if v, err := f.Await(); err != nil || v != 1 || f.TaskID() != futures[0].TaskID() {
+			t.Errorf("第 %d 个提交得到任务 %d 的结果 %d %v，应合并到任务 %d", i+1, f.TaskID()+1, v, err, futures[0].TaskID()+1)
+		}
+	}
+
+	// 保留期内直接返回上次的结果，过期后重新执行
+	if v, _ := Submit(scheduler, build, TaskOptions{Key: "report"}).Await(); v != 1 {
+		t.Errorf("保留期内提交得到 %d，应为上次的结果 1", v)
+	}
+	clock.Advance(time.Minute)
+	if v, _ := Submit(scheduler, build, TaskOptions{Key: "report"}).Await(); v != 2 {
+		t.Errorf("保留期过后提交得到 %d，应重新执行", v)
+	}
+	if n := builds.Load(); n != 2 {
+		t.Errorf("任务执行了 %d 次，应为 2", n)
+	}
+}
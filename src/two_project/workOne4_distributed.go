@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrLeaseExpired = errors.New("租约已过期或任务已取消")
+
+// 等待远程 worker 执行的任务
+type remoteTask struct {
+	typeName string
+	payload  json.RawMessage
+	lease    string // 被领取后的租约ID
+	worker   string
+	expires  time.Time
+	done     chan error // 远程执行的结果
+}
+
+// 分布式协调者：持有等待远程执行的任务，worker 通过 HTTP 领取任务、续约和上报结果
+// 协调者本身不执行任务，配合 TaskScheduler 使用：调度器负责依赖、重试、超时和结果，
+// 每个任务在调度器中的执行就是等待某个远程 worker 完成它
+type Coordinator struct {
+	leaseTTL time.Duration
+	logf     func(format string, args ...any)
+
+	mu      sync.Mutex
+	pending []*remoteTask          // 等待领取，先进先出
+	leased  map[string]*remoteTask // 按租约ID索引
+	changed chan struct{}          // 有新任务时关闭，唤醒等待领取的请求
+}
+
+// 创建协调者，leaseTTL 内没有收到心跳的任务会重新排队
+func NewCoordinator(leaseTTL time.Duration) *Coordinator {
+	return &Coordinator{
+		leaseTTL: leaseTTL,
+		logf:     func(format string, args ...any) { fmt.Printf(format, args...) },
+		leased:   make(map[string]*remoteTask),
+		changed:  make(chan struct{}),
+	}
+}
+
+// 设置协调者的日志输出，通常传入调度器的 logf，随调度器的安静模式一起关闭
+func (c *Coordinator) SetLogger(logf func(format string, args ...any)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.logf = logf
+}
+
+// 创建一个注册表，其中的任务类型都交给远程 worker 执行
+// 设置到调度器后，SubmitNamed、任务文件和任务日志都可以照常使用
+func (c *Coordinator) RemoteRegistry(types ...string) *TaskRegistry {
+	registry := NewTaskRegistry()
+	for _, typeName := range types {
+		registry.Register(typeName, func(ctx context.Context, payload json.RawMessage) error {
+			return c.run(ctx, typeName, payload)
+		})
+	}
+	return registry
+}
+
+// 把任务交给远程 worker 并等待结果，ctx 结束时撤回任务
+func (c *Coordinator) run(ctx context.Context, typeName string, payload json.RawMessage) error {
+	task := &remoteTask{typeName: typeName, payload: payload, done: make(chan error, 1)}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, task)
+	c.notifyLocked()
+	c.mu.Unlock()
+
+	select {
+	case err := <-task.done:
+		return err
+	case <-ctx.Done():
+		c.withdraw(task)
+		return ctx.Err()
+	}
+}
+
+func (c *Coordinator) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// 撤回任务：还没被领取的从队列中删除，已被领取的让租约失效
+func (c *Coordinator) withdraw(task *remoteTask) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if task.lease != "" {
+		delete(c.leased, task.lease)
+		return
+	}
+	for i, t := range c.pending {
+		if t == task {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// 把租约过期的任务放回队列头部
+func (c *Coordinator) reapLocked(now time.Time) {
+	var expired []*remoteTask
+	for lease, task := range c.leased {
+		if now.After(task.expires) {
+			delete(c.leased, lease)
+			c.logf("   [协调者] worker %s 的租约过期，任务 %s 重新排队\n", task.worker, task.typeName)
+			task.lease = ""
+			task.worker = ""
+			expired = append(expired, task)
+		}
+	}
+	if len(expired) > 0 {
+		c.pending = append(expired, c.pending...)
+		c.notifyLocked()
+	}
+}
+
+// 领取一个任务，没有任务时最多等待 wait
+func (c *Coordinator) claim(ctx context.Context, worker string, wait time.Duration) *claimResponse {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		c.reapLocked(now)
+		if len(c.pending) > 0 {
+			task := c.pending[0]
+			c.pending = c.pending[1:]
+			task.lease = newJournalID()
+			task.worker = worker
+			task.expires = now.Add(c.leaseTTL)
+			c.leased[task.lease] = task
+			c.mu.Unlock()
+
+			return &claimResponse{
+				Lease:   task.lease,
+				Type:    task.typeName,
+				Payload: task.payload,
+				TTLMs:   c.leaseTTL.Milliseconds(),
+			}
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// 续约，租约不存在时返回 false
+func (c *Coordinator) heartbeat(lease string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reapLocked(time.Now())
+	task, ok := c.leased[lease]
+	if !ok {
+		return false
+	}
+	task.expires = time.Now().Add(c.leaseTTL)
+	return true
+}
+
+// worker 退出前交还租约，任务立即回到队列头部，租约不存在时返回 false
+func (c *Coordinator) release(lease string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	task, ok := c.leased[lease]
+	if !ok {
+		return false
+	}
+	delete(c.leased, lease)
+	c.logf("   [协调者] worker %s 交还了任务 %s，重新排队\n", task.worker, task.typeName)
+	task.lease = ""
+	task.worker = ""
+	c.pending = append([]*remoteTask{task}, c.pending...)
+	c.notifyLocked()
+	return true
+}
+
+// 上报结果，租约不存在时结果被丢弃并返回 false
+func (c *Coordinator) report(req reportRequest) bool {
+	c.mu.Lock()
+	task, ok := c.leased[req.Lease]
+	if ok {
+		delete(c.leased, req.Lease)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	var err error
+	switch {
+	case req.Panic:
+		err = &PanicError{Value: req.Error, Stack: []byte(req.Stack)}
+	case req.Error != "":
+		err = errors.New(req.Error)
+	}
+	task.done <- err
+	return true
+}
+
+// 等待领取和已被领取的任务数
+func (c *Coordinator) Stats() (pending, leased int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.pending), len(c.leased)
+}
+
+// 请求和响应
+type claimRequest struct {
+	Worker string `json:"worker"`
+	WaitMs int64  `json:"wait_ms"`
+}
+
+type claimResponse struct {
+	Lease   string          `json:"lease"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	TTLMs   int64           `json:"ttl_ms"`
+}
+
+type leaseRequest struct {
+	Lease string `json:"lease"`
+}
+
+type reportRequest struct {
+	Lease string `json:"lease"`
+	Error string `json:"error,omitempty"`
+	Panic bool   `json:"panic,omitempty"`
+	Stack string `json:"stack,omitempty"`
+}
+
+// HTTP 接口：
+//
+//	POST /claim      领取任务，没有任务时返回 204
+//	POST /heartbeat  续约，租约失效时返回 410，worker 应放弃执行
+//	POST /report     上报结果，租约失效时返回 410
+//	POST /release    交还租约，任务重新排队，租约失效时返回 410
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/claim":
+		var req claimRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wait := min(time.Duration(req.WaitMs)*time.Millisecond, 30*time.Second)
+		resp := c.claim(r.Context(), req.Worker, wait)
+		if resp == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+	case "/heartbeat":
+		var req leaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !c.heartbeat(req.Lease) {
+			http.Error(w, ErrLeaseExpired.Error(), http.StatusGone)
+		}
+
+	case "/report":
+		var req reportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !c.report(req) {
+			http.Error(w, ErrLeaseExpired.Error(), http.StatusGone)
+		}
+
+	case "/release":
+		var req leaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !c.release(req.Lease) {
+			http.Error(w, ErrLeaseExpired.Error(), http.StatusGone)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// 远程 worker：从协调者领取任务，用本地注册表执行，执行期间定期续约
+type RemoteWorker struct {
+	url         string
+	id          string
+	registry    *TaskRegistry
+	client      *http.Client
+	concurrency int
+	grace       time.Duration // 停止后运行中的任务最多再执行的时间
+	logf        func(format string, args ...any)
+}
+
+func NewRemoteWorker(coordinatorURL, id string, registry *TaskRegistry) *RemoteWorker {
+	return &RemoteWorker{
+		url:         coordinatorURL,
+		id:          id,
+		registry:    registry,
+		client:      &http.Client{Timeout: 35 * time.Second},
+		concurrency: 1,
+		logf:        func(format string, args ...any) { fmt.Printf(format, args...) },
+	}
+}
+
+// 设置同时执行的任务数
+func (w *RemoteWorker) SetConcurrency(n int) {
+	w.concurrency = max(n, 1)
+}
+
+// 设置 worker 的日志输出，与协调者相同，可以传入调度器的 logf 随安静模式一起关闭
+func (w *RemoteWorker) SetLogger(logf func(format string, args ...any)) {
+	w.logf = logf
+}
+
+// 设置停止时等待运行中任务的时间，默认为 0，即立即放弃
+func (w *RemoteWorker) SetGrace(grace time.Duration) {
+	w.grace = max(grace, 0)
+}
+
+// 持续领取并执行任务，直到 ctx 结束
+// ctx 结束后不再领取新任务，运行中的任务最多再执行 grace，完成的照常上报，
+// 没完成的取消执行并交还租约，由协调者立即重新排队
+func (w *RemoteWorker) Run(ctx context.Context) {
+	workCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-workCtx.Done():
+			return
+		}
+		timer := time.NewTimer(w.grace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-workCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx, workCtx)
+		}()
+	}
+	wg.Wait()
+}
+
+// ctx 控制领取新任务，workCtx 控制任务的执行和上报
+func (w *RemoteWorker) loop(ctx, workCtx context.Context) {
+	for ctx.Err() == nil {
+		var task claimResponse
+		status, err := w.post(ctx, "/claim", claimRequest{Worker: w.id, WaitMs: 5000}, &task)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.logf("   [worker %s] 连接协调者失败: %v\n", w.id, err)
+				sleepContext(ctx, 500*time.Millisecond)
+			}
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		w.execute(workCtx, task)
+	}
+}
+
+// 执行一个任务，租约失效时取消执行，ctx 结束时交还租约
+func (w *RemoteWorker) execute(ctx context.Context, task claimResponse) {
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 每隔租约时间的三分之一续约一次
+	interval := max(time.Duration(task.TTLMs)*time.Millisecond/3, 10*time.Millisecond)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-taskCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			status, err := w.post(taskCtx, "/heartbeat", leaseRequest{Lease: task.Lease}, nil)
+			if err == nil && status == http.StatusGone {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	err := ErrUnknownTaskType
+	fn, lookupErr := w.registry.NewTask(task.Type, task.Payload)
+	if lookupErr == nil {
+		err = safeCall(taskCtx, fn)
+	} else {
+		err = lookupErr
+	}
+	if ctx.Err() != nil {
+		// 等待时间已到，交还租约让其他 worker 尽快接手
+		releaseCtx, cancelRelease := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelRelease()
+		if _, err := w.post(releaseCtx, "/release", leaseRequest{Lease: task.Lease}, nil); err == nil {
+			w.logf("   [worker %s] 停止前交还任务 %s\n", w.id, task.Type)
+		}
+		return
+	}
+	if taskCtx.Err() != nil {
+		w.logf("   [worker %s] 租约失效，放弃任务 %s\n", w.id, task.Type)
+		return
+	}
+
+	report := reportRequest{Lease: task.Lease}
+	if err != nil {
+		report.Error = err.Error()
+		var pe *PanicError
+		if errors.As(err, &pe) {
+			report.Panic = true
+			report.Error = fmt.Sprint(pe.Value)
+			report.Stack = string(pe.Stack)
+		}
+	}
+	if _, err := w.post(ctx, "/report", report, nil); err != nil && ctx.Err() == nil {
+		w.logf("   [worker %s] 上报结果失败: %v\n", w.id, err)
+	}
+}
+
+// 发送 JSON 请求，out 不为 nil 且状态码为 200 时解析响应
+func (w *RemoteWorker) post(ctx context.Context, path string, in, out any) (int, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// 命令行入口：启动协调者执行任务文件，任务由远程 worker 执行
+func runCoordinator(addr, jobFile string, leaseTTL, grace time.Duration) int {
+	spec, err := LoadJob(jobFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取任务文件失败: %v\n", err)
+		return 2
+	}
+
+	coordinator := NewCoordinator(leaseTTL)
+	scheduler, err := spec.Build(coordinator.RemoteRegistry(NewBuiltinRegistry().Names()...))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	coordinator.SetLogger(scheduler.logf)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "协调者启动失败: %v\n", err)
+		return 2
+	}
+	server := &http.Server{Handler: coordinator}
+	serveErr := make(chan error, 1)
+	go func() {
+		// 服务中途出错时没有 worker 能再上报结果，取消剩下的任务
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+			scheduler.Cancel()
+		}
+	}()
+	defer server.Close()
+	fmt.Printf("协调者监听 %s，等待 worker 领取任务\n", listener.Addr())
+
+	stop := scheduler.NotifyShutdown(grace)
+	defer stop()
+	ok := spec.execute(scheduler)
+	select {
+	case err := <-serveErr:
+		fmt.Fprintf(os.Stderr, "协调者服务出错: %v\n", err)
+		return 2
+	default:
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// 命令行入口：启动远程 worker，使用内置任务类型
+// 收到 SIGINT 或 SIGTERM 后不再领取新任务，最多等待 grace 让运行中的任务结束，
+// 没完成的任务交还给协调者；第二次收到信号时立即退出
+func runRemoteWorker(coordinatorURL, id string, concurrency int, grace time.Duration) int {
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	worker := NewRemoteWorker(coordinatorURL, id, NewBuiltinRegistry())
+	worker.SetConcurrency(concurrency)
+	worker.SetGrace(grace)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() {
+		// 恢复默认的信号处理，再次收到信号时进程直接退出
+		stop()
+		fmt.Printf("worker %s 收到停止信号，不再领取新任务，最多等待 %v\n", id, grace)
+	})
+
+	fmt.Printf("worker %s 连接协调者 %s\n", id, coordinatorURL)
+	worker.Run(ctx)
+	return 0
+}
+
+func demoDistributed() {
+	fmt.Println("演示19：远程 worker 分布式执行")
+
+	coordinator := NewCoordinator(300 * time.Millisecond)
+	url, stopServer, err := serveLocal(coordinator)
+	if err != nil {
+		fmt.Printf("启动协调者失败: %v\n\n", err)
+		return
+	}
+	defer stopServer()
+
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetRegistry(coordinator.RemoteRegistry("sleep", "fail"))
+	coordinator.SetLogger(scheduler.logf)
+	scheduler.Start()
+
+	// 两个 worker，其中 worker-2 在执行任务时停止，没有等待时间，它交还的任务由 worker-1 完成
+	// 进程崩溃来不及交还时，任务在租约过期后重新排队
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	worker1 := NewRemoteWorker(url, "worker-1", NewBuiltinRegistry())
+	worker1.SetLogger(scheduler.logf)
+	go worker1.Run(ctx)
+
+	stopCtx, stop := context.WithCancel(ctx)
+	worker2 := NewRemoteWorker(url, "worker-2", NewBuiltinRegistry())
+	worker2.SetLogger(scheduler.logf)
+	go worker2.Run(stopCtx)
+
+	for i := 1; i <= 4; i++ {
+		payload := sleepPayload{Message: fmt.Sprintf("远程任务 %d 完成", i), Millis: 200}
+		scheduler.SubmitNamed("sleep", payload, TaskOptions{Name: fmt.Sprintf("远程任务%d", i)})
+	}
+	scheduler.SubmitNamed("fail", map[string]string{"message": "远程任务出错"}, TaskOptions{Name: "出错的任务"})
+
+	time.Sleep(100 * time.Millisecond)
+	fmt.Println("worker-2 停止")
+	stop()
+
+	scheduler.Drain()
+	pending, leased := coordinator.Stats()
+	fmt.Printf("协调者剩余: 排队 %d，执行中 %d\n\n", pending, leased)
+}
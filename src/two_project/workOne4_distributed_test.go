@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 协调者、调度器和远程 worker 使用的注册表，block 任务在 block 关闭或被取消时结束
+type remoteFixture struct {
+	coordinator *Coordinator
+	url         string
+	scheduler   *TaskScheduler
+	registry    *TaskRegistry
+	started     chan struct{} // block 任务开始执行时收到通知
+}
+
+func startRemote(t *testing.T, block chan struct{}) *remoteFixture {
+	t.Helper()
+
+	coordinator := NewCoordinator(time.Minute)
+	server := httptest.NewServer(coordinator)
+	t.Cleanup(server.Close)
+
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetRegistry(coordinator.RemoteRegistry("block"))
+	coordinator.SetLogger(scheduler.logf)
+	scheduler.Start()
+	t.Cleanup(func() { scheduler.Stop() })
+
+	started := make(chan struct{}, 1)
+	registry := NewTaskRegistry()
+	registry.Register("block", func(ctx context.Context, payload json.RawMessage) error {
+		started <- struct{}{}
+		select {
+		case <-block:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	return &remoteFixture{coordinator, server.URL, scheduler, registry, started}
+}
+
+func TestRemoteWorkerFinishesTasksWithinGrace(t *testing.T) {
+	block := make(chan struct{})
+	f := startRemote(t, block)
+	taskID, _ := f.scheduler.SubmitNamed("block", nil, TaskOptions{})
+
+	worker := NewRemoteWorker(f.url, "w", f.registry)
+	worker.SetGrace(5 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	// 停止后任务仍在等待时间内完成，结果照常上报
+	<-f.started
+	cancel()
+	close(block)
+	<-done
+	if result, _ := f.scheduler.Wait(taskID); !result.Success {
+		t.Errorf("等待时间内完成的任务结果为 %s: %v", result.Status, result.Error)
+	}
+}
+
+func TestRemoteWorkerReleasesLeaseAfterGrace(t *testing.T) {
+	f := startRemote(t, make(chan struct{}))
+	f.scheduler.SubmitNamed("block", nil, TaskOptions{})
+
+	// worker 的日志通过 SetLogger 输出，不直接写标准输出
+	var mu sync.Mutex
+	var logs []string
+	worker := NewRemoteWorker(f.url, "w", f.registry)
+	worker.SetGrace(10 * time.Millisecond)
+	worker.SetLogger(func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	// 超过等待时间的任务交还给协调者，不用等一分钟的租约过期就重新排队
+	<-f.started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker 停止后没有退出")
+	}
+	if pending, leased := f.coordinator.Stats(); pending != 1 || leased != 0 {
+		t.Errorf("协调者中排队 %d，执行中 %d，应为排队 1，执行中 0", pending, leased)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logs) != 1 || !strings.Contains(logs[0], "停止前交还任务") {
+		t.Errorf("worker 的日志为 %q，应只有一条交还任务的记录", logs)
+	}
+}
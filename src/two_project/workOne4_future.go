@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 幂等键合并到的任务不是以相同返回值类型提交的，拿不到它的返回值
+var ErrFutureTypeMismatch = errors.New("幂等键对应的任务返回值类型不同")
+
+// 带返回值任务的执行结果
+type TypedResult[T any] struct {
+	TaskResult
+	Value T // 任务成功时的返回值，失败时为零值
+}
+
+// 异步任务的返回值
+type Future[T any] struct {
+	taskID int
+	done   chan struct{}
+
+	mu        sync.Mutex
+	value     T // 最近一次成功尝试的返回值
+	result    TypedResult[T]
+	finished  bool
+	callbacks []func(TypedResult[T])
+}
+
+// 提交带返回值的任务，调度器需要已经以服务模式启动
+// 提交失败时返回的 Future 已经结束，Await 返回提交错误
+// 按幂等键合并到已有任务时，返回值与最先提交的 Future 相同；
+// 已有任务不是通过 Submit 以相同类型提交的，Await 返回 ErrFutureTypeMismatch
+func Submit[T any](ts *TaskScheduler, fn func(ctx context.Context) (T, error), opt TaskOptions) *Future[T] {
+	f := &Future[T]{taskID: -1, done: make(chan struct{})}
+
+	task := func(ctx context.Context) error {
+		v, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		// 超时或取消后才返回的值不可信，按超时或取消处理
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		f.mu.Lock()
+		f.value = v
+		f.mu.Unlock()
+		return nil
+	}
+
+	var origin *Future[T]
+	mismatch := false
+	taskID, err := ts.submitWith(task, opt, func(taskID int, coalesced bool) {
+		if opt.Key == "" {
+			return
+		}
+		k := ts.keys[opt.Key]
+		if !coalesced {
+			k.future = f
+		} else if prev, ok := k.future.(*Future[T]); ok {
+			origin = prev
+		} else {
+			mismatch = true
+		}
+	})
+	if err != nil {
+		f.complete(TaskResult{TaskID: -1, Name: opt.Name, Error: err, Status: StatusFailed})
+		return f
+	}
+
+	f.taskID = taskID
+	if mismatch {
+		f.complete(TaskResult{
+			TaskID: taskID,
+			Name:   opt.Name,
+			Error:  fmt.Errorf("%w: %s", ErrFutureTypeMismatch, opt.Key),
+			Status: StatusFailed,
+		})
+		return f
+	}
+	if origin != nil {
+		origin.OnComplete(func(r TypedResult[T]) {
+			f.mu.Lock()
+			f.value = r.Value
+			f.mu.Unlock()
+			f.complete(r.TaskResult)
+		})
+		return f
+	}
+	go f.wait(ts, opt.Name)
+	return f
+}
+
+// 等待调度器中的任务结束，任务已被清理或无法等待时 Future 以失败结束
+func (f *Future[T]) wait(ts *TaskScheduler, name string) {
+	result, err := ts.Wait(f.taskID)
+	if err != nil {
+		result = TaskResult{TaskID: f.taskID, Name: name, Error: err, Status: StatusFailed}
+	}
+	f.complete(result)
+}
+
+// 记录结果并调用回调
+func (f *Future[T]) complete(result TaskResult) {
+	f.mu.Lock()
+	f.result = TypedResult[T]{TaskResult: result}
+	if result.Success {
+		f.result.Value = f.value
+	}
+	f.finished = true
+	callbacks := f.callbacks
+	f.callbacks = nil
+	f.mu.Unlock()
+
+	// 回调先于 Await 返回
+	for _, cb := range callbacks {
+		cb(f.result)
+	}
+	close(f.done)
+}
+
+// 任务ID，可以用在其他任务的 DependsOn 中；提交失败时为 -1
+func (f *Future[T]) TaskID() int {
+	return f.taskID
+}
+
+// 任务结束时关闭的 channel
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// 等待任务结束，返回任务的返回值和错误
+func (f *Future[T]) Await() (T, error) {
+	r := f.AwaitResult()
+	return r.Value, r.Error
+}
+
+// 等待任务结束，ctx 结束时提前返回 ctx 的错误
+func (f *Future[T]) AwaitContext(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.Await()
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// 等待任务结束，返回值和执行信息
+func (f *Future[T]) AwaitResult() TypedResult[T] {
+	<-f.done
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.result
+}
+
+// 注册完成回调，任务已经结束时立即在当前协程中调用
+// 其他情况下回调在调度器内部的协程中依次调用，不应阻塞
+func (f *Future[T]) OnComplete(cb func(TypedResult[T])) {
+	f.mu.Lock()
+	if !f.finished {
+		f.callbacks = append(f.callbacks, cb)
+		f.mu.Unlock()
+		return
+	}
+	result := f.result
+	f.mu.Unlock()
+
+	cb(result)
+}
+
+// 等待全部任务结束，按顺序返回返回值，所有失败任务的错误合并后返回
+func AwaitAll[T any](futures ...*Future[T]) ([]T, error) {
+	values := make([]T, len(futures))
+	var errs []error
+	for i, f := range futures {
+		v, err := f.Await()
+		values[i] = v
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return values, errors.Join(errs...)
+}
+
+// 等待任意一个任务结束，返回它的下标、返回值和错误
+func AwaitAny[T any](futures ...*Future[T]) (int, T, error) {
+	if len(futures) == 0 {
+		var zero T
+		return -1, zero, errors.New("没有可以等待的任务")
+	}
+
+	first := make(chan int, len(futures))
+	for i, f := range futures {
+		go func() {
+			<-f.done
+			first <- i
+		}()
+	}
+	i := <-first
+	v, err := futures[i].Await()
+	return i, v, err
+}
+
+func demoFutures() {
+	fmt.Println("演示18：带返回值的任务")
+
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetQuiet(true)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	// 分段统计素数个数，最后汇总
+	countPrimes := func(from, to int) func(ctx context.Context) (int, error) {
+		return func(ctx context.Context) (int, error) {
+			count := 0
+			for n := max(from, 2); n < to; n++ {
+				prime := true
+				for d := 2; d*d <= n; d++ {
+					if n%d == 0 {
+						prime = false
+						break
+					}
+				}
+				if prime {
+					count++
+				}
+			}
+			return count, nil
+		}
+	}
+
+	var parts []*Future[int]
+	for i := 0; i < 4; i++ {
+		from, to := i*50000, (i+1)*50000
+		f := Submit(scheduler, countPrimes(from, to), TaskOptions{Name: fmt.Sprintf("素数[%d,%d)", from, to)})
+		f.OnComplete(func(r TypedResult[int]) {
+			fmt.Printf("   %s: %d 个，耗时 %v\n", r.Name, r.Value, r.Duration.Round(time.Millisecond))
+		})
+		parts = append(parts, f)
+	}
+	counts, err := AwaitAll(parts...)
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	fmt.Printf("20 万以内共有 %d 个素数，错误: %v\n", total, err)
+
+	// 向多个镜像请求同一份数据，用最先返回的结果
+	mirror := func(name string, delay time.Duration) func(ctx context.Context) (string, error) {
+		return func(ctx context.Context) (string, error) {
+			if !sleepContext(ctx, delay) {
+				return "", ctx.Err()
+			}
+			return name + " 的数据", nil
+		}
+	}
+	mirrors := []*Future[string]{
+		Submit(scheduler, mirror("北京", 300*time.Millisecond), TaskOptions{Name: "北京"}),
+		Submit(scheduler, mirror("上海", 100*time.Millisecond), TaskOptions{Name: "上海"}),
+		Submit(scheduler, mirror("广州", 200*time.Millisecond), TaskOptions{Name: "广州"}),
+	}
+	i, data, err := AwaitAny(mirrors...)
+	fmt.Printf("最先返回的是第 %d 个镜像: %s，错误: %v\n", i+1, data, err)
+
+	// 失败的任务返回零值和错误，执行信息中可以看到尝试次数
+	failed := Submit(scheduler, func(ctx context.Context) (int, error) {
+		return 42, errBadRequest
+	}, TaskOptions{Name: "校验", Retry: &RetryPolicy{MaxAttempts: 2}})
+	r := failed.AwaitResult()
+	fmt.Printf("%s: 值 %d，状态 %s，尝试 %d 次，错误: %v\n\n", r.Name, r.Value, r.Status, len(r.Attempts), r.Error)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubmitValueAfterTimeoutIsTimeout(t *testing.T) {
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetTimeout(50 * time.Millisecond)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	// 子任务忽略取消，任务超时后才返回值
+	f := Submit(scheduler, func(ctx context.Context) (int, error) {
+		Fork(ctx, func(ctx context.Context) struct{} {
+			time.Sleep(time.Second)
+			return struct{}{}
+		}).Join()
+		return 1, nil
+	}, TaskOptions{Name: "超时后返回"})
+
+	r := f.AwaitResult()
+	if r.Success || r.Status != StatusTimeout {
+		t.Fatalf("超时后返回值的任务 success=%v，状态为 %s，应为超时", r.Success, r.Status)
+	}
+	if !errors.Is(r.Error, ErrTaskTimeout) {
+		t.Errorf("错误为 %v，应为 ErrTaskTimeout", r.Error)
+	}
+	if r.Value != 0 {
+		t.Errorf("超时任务的值为 %d，应为零值", r.Value)
+	}
+}
+
+func TestSubmitValueAfterCancelIsCancelled(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	started := make(chan struct{})
+	f := Submit(scheduler, func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 1, nil
+	}, TaskOptions{})
+	<-started
+	scheduler.CancelTask(f.TaskID())
+
+	if r := f.AwaitResult(); r.Success || r.Status != StatusCancelled {
+		t.Errorf("取消后返回值的任务 success=%v，状态为 %s，应为取消", r.Success, r.Status)
+	}
+}
+
+func TestFutureFailsWhenWaitFails(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	// 调度器中没有这个任务，Wait 出错时 Future 不能当作成功
+	f := &Future[int]{taskID: 7, done: make(chan struct{})}
+	f.wait(scheduler, "不存在")
+	v, err := f.Await()
+	if !errors.Is(err, ErrUnknownTask) || v != 0 {
+		t.Errorf("Wait 出错时 Await 返回 (%d, %v)，应为 ErrUnknownTask", v, err)
+	}
+	if r := f.AwaitResult(); r.Success || r.Status != StatusFailed {
+		t.Errorf("Wait 出错时结果 success=%v，状态为 %s，应为失败", r.Success, r.Status)
+	}
+}
+
+func TestSubmitCoalescedWithDifferentTypeFails(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetDedupe(DedupeCoalesce, time.Minute)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	release := make(chan struct{})
+	first := Submit(scheduler, func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	}, TaskOptions{Key: "报表"})
+	second := Submit(scheduler, func(ctx context.Context) (string, error) {
+		return "不会执行", nil
+	}, TaskOptions{Key: "报表"})
+	if _, err := second.Await(); !errors.Is(err, ErrFutureTypeMismatch) {
+		t.Errorf("返回值类型不同的合并返回 %v，应为 ErrFutureTypeMismatch", err)
+	}
+
+	// 先用普通 Submit 提交的任务没有返回值可以共享
+	plain, _ := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{Key: "日报"})
+	third := Submit(scheduler, func(ctx context.Context) (int, error) { return 3, nil }, TaskOptions{Key: "日报"})
+	if _, err := third.Await(); !errors.Is(err, ErrFutureTypeMismatch) {
+		t.Errorf("合并到普通任务返回 %v，应为 ErrFutureTypeMismatch", err)
+	}
+	if third.TaskID() != plain {
+		t.Errorf("合并后的任务ID为 %d，应为已有任务 %d", third.TaskID(), plain)
+	}
+
+	close(release)
+	if v, err := first.Await(); v != 1 || err != nil {
+		t.Errorf("最先提交的任务返回 (%d, %v)，应为 (1, nil)", v, err)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrInvalidJob = errors.New("无效的任务文件")
+
+// 任务文件中的时长，使用 "500ms"、"2s" 这样的字符串
+type jobDuration time.Duration
+
+func (d *jobDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("时长需要写成字符串: %s", data)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = jobDuration(v)
+	return nil
+}
+
+func (d jobDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// 任务文件：描述一次运行的全部任务和调度参数（目前只支持 JSON）
+type JobSpec struct {
+	Name    string             `json:"name"`
+	Mode    string             `json:"mode"`    // serial 或 parallel，默认 parallel
+	Workers int                `json:"workers"` // 并行的 worker 数，默认 4
+	Timeout jobDuration        `json:"timeout"` // 单次尝试的超时时间，默认不限制
+	Retry   *RetrySpec         `json:"retry"`   // 默认重试策略
+	Budget  *Resources         `json:"budget"`  // 资源预算，默认不限制
+	Tenants map[string]float64 `json:"tenants"` // 租户权重，默认都为 1
+	Tasks   []JobTask          `json:"tasks"`
+}
+
+// 任务文件中的单个任务
+type JobTask struct {
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`   // 注册表中的任务类型
+	Params    json.RawMessage `json:"params"` // 传给任务的参数
+	DependsOn []string        `json:"depends_on"`
+	Priority  int             `json:"priority"`
+	Group     string          `json:"group"`
+	Tenant    string          `json:"tenant"`
+	CPU       int             `json:"cpu"`       // 声明的 CPU 单位
+	MemoryMB  int             `json:"memory_mb"` // 声明的内存
+	Retry     *RetrySpec      `json:"retry"`
+}
+
+// 任务文件中的重试策略
+type RetrySpec struct {
+	MaxAttempts    int         `json:"max_attempts"`
+	InitialBackoff jobDuration `json:"initial_backoff"`
+	MaxBackoff     jobDuration `json:"max_backoff"`
+	Multiplier     float64     `json:"multiplier"`
+	Jitter         float64     `json:"jitter"`
+}
+
+// 重试策略转换为可以写入 JSON 的形式，Retryable 函数无法保存
+func retrySpecOf(p *RetryPolicy) *RetrySpec {
+	if p == nil {
+		return nil
+	}
+	return &RetrySpec{
+		MaxAttempts:    p.MaxAttempts,
+		InitialBackoff: jobDuration(p.InitialBackoff),
+		MaxBackoff:     jobDuration(p.MaxBackoff),
+		Multiplier:     p.Multiplier,
+		Jitter:         p.Jitter,
+	}
+}
+
+func (r *RetrySpec) policy() *RetryPolicy {
+	if r == nil {
+		return nil
+	}
+	return &RetryPolicy{
+		MaxAttempts:    r.MaxAttempts,
+		InitialBackoff: time.Duration(r.InitialBackoff),
+		MaxBackoff:     time.Duration(r.MaxBackoff),
+		Multiplier:     r.Multiplier,
+		Jitter:         r.Jitter,
+	}
+}
+
+// 读取任务文件
+func LoadJob(path string) (*JobSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJob(data)
+}
+
+// 解析任务文件内容，拼错的字段名（例如 depend_on、retires）会报错而不是被忽略
+func ParseJob(data []byte) (*JobSpec, error) {
+	var spec JobSpec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		// encoding/json 没有导出未知字段的错误类型，只能从错误信息中取字段名，
+		// 信息格式变了就退回原始错误
+		if key, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return nil, fmt.Errorf("%w: 未知的字段 %s", ErrInvalidJob, key)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJob, err)
+	}
+	// 顶层对象之后只允许空白
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: 顶层对象之后还有多余的内容", ErrInvalidJob)
+	}
+
+	if spec.Mode == "" {
+		spec.Mode = "parallel"
+	}
+	if spec.Mode != "serial" && spec.Mode != "parallel" {
+		return nil, fmt.Errorf("%w: 未知的执行模式 %q", ErrInvalidJob, spec.Mode)
+	}
+	if spec.Workers <= 0 {
+		spec.Workers = 4
+	}
+	return &spec, nil
+}
+
+// 根据任务文件创建调度器，任务类型从注册表中查找
+func (spec *JobSpec) Build(registry *TaskRegistry) (*TaskScheduler, error) {
+	scheduler := NewTaskScheduler(spec.Workers)
+	scheduler.SetRegistry(registry)
+	scheduler.SetTimeout(time.Duration(spec.Timeout))
+	if p := spec.Retry.policy(); p != nil {
+		scheduler.SetRetryPolicy(*p)
+	}
+	if spec.Budget != nil {
+		scheduler.SetResourceBudget(*spec.Budget)
+	}
+	for tenant, weight := range spec.Tenants {
+		scheduler.SetTenantWeight(tenant, weight)
+	}
+
+	// 先添加全部任务，依赖可以引用后面的任务
+	taskIDs := make(map[string]int)
+	for i, t := range spec.Tasks {
+		if t.Name == "" {
+			return nil, fmt.Errorf("%w: 第 %d 个任务没有名称", ErrInvalidJob, i+1)
+		}
+		if _, ok := taskIDs[t.Name]; ok {
+			return nil, fmt.Errorf("%w: 任务名称 %q 重复", ErrInvalidJob, t.Name)
+		}
+
+		task, err := registry.NewTask(t.Type, t.Params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 任务 %q: %v", ErrInvalidJob, t.Name, err)
+		}
+		taskID, err := scheduler.AddTaskWithOptions(task, TaskOptions{
+			Name:      t.Name,
+			Priority:  t.Priority,
+			Group:     t.Group,
+			Tenant:    t.Tenant,
+			Resources: Resources{CPU: t.CPU, MemoryMB: t.MemoryMB},
+			Retry:     t.Retry.policy(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		taskIDs[t.Name] = taskID
+	}
+
+	for _, t := range spec.Tasks {
+		for _, dep := range t.DependsOn {
+			depID, ok := taskIDs[dep]
+			if !ok {
+				return nil, fmt.Errorf("%w: 任务 %q 依赖的 %q 不存在", ErrInvalidJob, t.Name, dep)
+			}
+			if err := scheduler.AddDependency(taskIDs[t.Name], depID); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+			}
+		}
+	}
+	return scheduler, nil
+}
+
+// 执行任务文件，所有任务都成功时返回 true
+func (spec *JobSpec) Run(registry *TaskRegistry) (bool, error) {
+	scheduler, err := spec.Build(registry)
+	if err != nil {
+		return false, err
+	}
+	return spec.execute(scheduler), nil
+}
+
+// 按任务文件的模式执行
+func (spec *JobSpec) execute(scheduler *TaskScheduler) bool {
+	if spec.Name != "" {
+		scheduler.logf("任务文件: %s\n", spec.Name)
+	}
+	if spec.Mode == "serial" {
+		scheduler.RunSerial()
+	} else {
+		scheduler.RunParallel()
+	}
+
+	for _, result := range scheduler.GetResults() {
+		if !result.Success {
+			return false
+		}
+	}
+	return true
+}
+
+// 命令行入口：0 表示全部成功，1 表示有任务失败，2 表示任务文件或参数有误
+// report 不是 text 时关闭默认的控制台输出，报告写入 reportFile 或标准输出
+// 报告写到标准输出时，任务自己的输出改写到标准错误，保证报告可以直接被解析
+// 收到 SIGINT 或 SIGTERM 时最多等待 grace 让运行中的任务结束
+// adminAddr 不为空时在这个地址提供 HTTP 管理接口
+func runJobFile(path, report, reportFile string, grace time.Duration, adminAddr string) int {
+	spec, err := LoadJob(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取任务文件失败: %v\n", err)
+		return 2
+	}
+
+	var taskOut io.Writer = os.Stdout
+	if report != "text" && reportFile == "" {
+		taskOut = os.Stderr
+	}
+	scheduler, err := spec.Build(newBuiltinRegistry(taskOut))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if reportFile != "" {
+		file, err := os.Create(reportFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "创建报告文件失败: %v\n", err)
+			return 2
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch report {
+	case "text":
+		if reportFile != "" {
+			scheduler.AddObserver(NewTextReporter(w))
+		}
+	case "jsonl":
+		scheduler.SetQuiet(true)
+		scheduler.AddObserver(NewJSONLinesReporter(w))
+	case "junit":
+		scheduler.SetQuiet(true)
+		scheduler.AddObserver(NewJUnitReporter(w, spec.Name))
+	case "json":
+		scheduler.SetQuiet(true)
+		scheduler.AddObserver(NewJSONSummaryReporter(w))
+	case "csv":
+		scheduler.SetQuiet(true)
+		scheduler.AddObserver(NewCSVSummaryReporter(w))
+	default:
+		fmt.Fprintf(os.Stderr, "未知的报告格式: %s\n", report)
+		return 2
+	}
+
+	if adminAddr != "" {
+		server := &http.Server{Addr: adminAddr, Handler: NewAdmin(scheduler)}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintf(os.Stderr, "管理接口启动失败: %v\n", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	stop := scheduler.NotifyShutdown(grace)
+	defer stop()
+	if !spec.execute(scheduler) {
+		return 1
+	}
+	return 0
+}
+
+// sleep 任务的参数
+type sleepPayload struct {
+	Message string `json:"message"`
+	Millis  int    `json:"millis"`
+}
+
+// 内置任务类型：sleep、fail、flaky、compute、http_get，任务输出写到标准输出
+func NewBuiltinRegistry() *TaskRegistry {
+	return newBuiltinRegistry(os.Stdout)
+}
+
+// 内置任务类型，任务输出写到 out
+func newBuiltinRegistry(out io.Writer) *TaskRegistry {
+	registry := NewTaskRegistry()
+
+	// 等待一段时间后打印消息
+	registry.Register("sleep", func(ctx context.Context, payload json.RawMessage) error {
+		var p sleepPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		if !sleepContext(ctx, time.Duration(p.Millis)*time.Millisecond) {
+			return ctx.Err()
+		}
+		if p.Message != "" {
+			fmt.Fprintf(out, "   %s\n", p.Message)
+		}
+		return nil
+	})
+
+	// 总是失败
+	registry.Register("fail", func(ctx context.Context, payload json.RawMessage) error {
+		var p struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(payload, &p)
+		if p.Message == "" {
+			p.Message = "任务失败"
+		}
+		return errors.New(p.Message)
+	})
+
+	// 按概率失败
+	registry.Register("flaky", func(ctx context.Context, payload json.RawMessage) error {
+		var p struct {
+			FailRate float64 `json:"fail_rate"`
+		}
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		if RandFrom(ctx).Float64() < p.FailRate {
+			return errors.New("随机失败")
+		}
+		return nil
+	})
+
+	// 计算密集型任务
+	registry.Register("compute", func(ctx context.Context, payload json.RawMessage) error {
+		var p struct {
+			Iterations int `json:"iterations"`
+		}
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		sum := 0
+		for i := 0; i < p.Iterations; i++ {
+			if i%100000 == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			sum += i * i
+		}
+		return nil
+	})
+
+	// 发送 GET 请求，检查状态码
+	registry.Register("http_get", func(ctx context.Context, payload json.RawMessage) error {
+		var p struct {
+			URL    string `json:"url"`
+			Status int    `json:"status"` // 期望的状态码，默认 200
+		}
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		if p.Status == 0 {
+			p.Status = http.StatusOK
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != p.Status {
+			return fmt.Errorf("状态码 %d，期望 %d", resp.StatusCode, p.Status)
+		}
+		return nil
+	})
+
+	return registry
+}
+
+func demoJobFile() {
+	fmt.Println("演示12：声明式任务文件")
+
+	spec, err := ParseJob([]byte(`{
+		"name": "数据同步",
+		"mode": "parallel",
+		"workers": 2,
+		"timeout": "1s",
+		"retry": {"max_attempts": 2, "initial_backoff": "50ms"},
+		"tasks": [
+			{"name": "抓取", "type": "sleep", "params": {"message": "抓取完成", "millis": 100}},
+			{"name": "转换", "type": "compute", "params": {"iterations": 1000000}, "depends_on": ["抓取"]},
+			{"name": "加载", "type": "sleep", "params": {"message": "加载完成", "millis": 100}, "depends_on": ["转换"]},
+			{"name": "通知", "type": "fail", "params": {"message": "通知服务不可用"}, "depends_on": ["加载"]}
+		]
+	}`))
+	if err != nil {
+		fmt.Printf("解析失败: %v\n", err)
+		return
+	}
+
+	ok, err := spec.Run(NewBuiltinRegistry())
+	fmt.Printf("全部成功: %v，错误: %v\n\n", ok, err)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseJobRejectsUnknownFields(t *testing.T) {
+	cases := map[string]string{
+		"depend_on": `{"tasks": [{"name": "a", "type": "sleep"}, {"name": "b", "type": "sleep", "depend_on": ["a"]}]}`,
+		"retires":   `{"retires": {"max_attempts": 3}, "tasks": []}`,
+		"jiter":     `{"tasks": [{"name": "a", "type": "sleep", "retry": {"max_attempts": 2, "jiter": 0.1}}]}`,
+	}
+	for key, data := range cases {
+		_, err := ParseJob([]byte(data))
+		if !errors.Is(err, ErrInvalidJob) || !strings.Contains(err.Error(), `"`+key+`"`) {
+			t.Errorf("拼错的字段 %s 返回 %v，应为 ErrInvalidJob 并指出字段名", key, err)
+		}
+	}
+
+	// params 中的字段由任务类型自己解析，不受限制
+	spec, err := ParseJob([]byte(`{"tasks": [{"name": "a", "type": "sleep", "params": {"anything": 1}}]}`))
+	if err != nil || len(spec.Tasks) != 1 {
+		t.Errorf("params 中的任意字段应当允许: %v", err)
+	}
+}
+
+func TestParseJobRejectsTrailingData(t *testing.T) {
+	for _, data := range []string{
+		`{"tasks": []} {"tasks": []}`,
+		`{"tasks": []} x`,
+		`{"tasks": []}}`,
+	} {
+		if _, err := ParseJob([]byte(data)); !errors.Is(err, ErrInvalidJob) {
+			t.Errorf("%s 返回 %v，应为 ErrInvalidJob", data, err)
+		}
+	}
+	if _, err := ParseJob([]byte("{\"tasks\": []}\n\n")); err != nil {
+		t.Errorf("结尾的空白应当允许: %v", err)
+	}
+}
+
+func TestParseJobKeepsDecodeError(t *testing.T) {
+	_, err := ParseJob([]byte(`{"workers": "four", "tasks": []}`))
+	var typeErr *json.UnmarshalTypeError
+	if !errors.Is(err, ErrInvalidJob) || !errors.As(err, &typeErr) {
+		t.Errorf("类型错误返回 %v，应同时包含 ErrInvalidJob 和原始的解码错误", err)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrJournalDependency = errors.New("依赖的任务没有写入日志")
+	ErrJournalClosed     = errors.New("任务日志已关闭")
+)
+
+// 日志记录类型
+const (
+	journalSubmit = "submit"
+	journalStart  = "start"
+	journalFinish = "finish"
+)
+
+// 日志中的一条记录，每行一个 JSON
+type journalRecord struct {
+	Op        string          `json:"op"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Priority  int             `json:"priority,omitempty"`
+	Group     string          `json:"group,omitempty"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Key       string          `json:"key,omitempty"`
+	Deps      []string        `json:"deps,omitempty"`
+	Resources Resources       `json:"resources,omitzero"`
+	Retry     *RetrySpec      `json:"retry,omitempty"`
+	Status    string          `json:"status,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Time      time.Time       `json:"time"`
+}
+
+// 任务预写日志：记录命名任务的提交、开始和结束，
+// 进程重启后重新执行没有结束的任务（至少执行一次）
+// 记录由单独的协程按提交顺序写入，同一批记录只落盘一次
+type Journal struct {
+	mu   sync.Mutex // 保护 file
+	path string
+	file *os.File
+
+	sendMu  sync.Mutex     // 保护 pending 和 closed
+	pending []journalWrite // 等待写入的记录，不限长度，持有调度器锁时提交也不会阻塞
+	closed  bool
+	wakeup  chan struct{} // 有新记录或关闭时通知写入协程
+	done    chan struct{}
+	onError func(err error) // 没有人等待的记录写入失败时调用
+}
+
+// 等待写入的记录
+type journalWrite struct {
+	rec     journalRecord
+	written chan error // 落盘后收到写入结果，为 nil 时不通知
+}
+
+// 打开日志文件，不存在时创建
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		path:   path,
+		file:   file,
+		wakeup: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go j.writer()
+	return j, nil
+}
+
+// 写完已经提交的记录后关闭日志文件
+func (j *Journal) Close() error {
+	j.sendMu.Lock()
+	j.closed = true
+	j.sendMu.Unlock()
+	j.notifyWriter()
+	<-j.done
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+// 提交一条记录，不等待写入，返回的通道在落盘后收到写入结果
+func (j *Journal) enqueue(rec journalRecord) <-chan error {
+	written := make(chan error, 1)
+	j.send(journalWrite{rec: rec, written: written})
+	return written
+}
+
+// 提交一条记录，写入失败时调用 onError
+func (j *Journal) post(rec journalRecord) {
+	j.send(journalWrite{rec: rec})
+}
+
+func (j *Journal) send(w journalWrite) {
+	j.sendMu.Lock()
+	if j.closed {
+		j.sendMu.Unlock()
+		j.report(w, ErrJournalClosed)
+		return
+	}
+	j.pending = append(j.pending, w)
+	j.sendMu.Unlock()
+	j.notifyWriter()
+}
+
+func (j *Journal) notifyWriter() {
+	select {
+	case j.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// 追加一条记录并等待落盘
+func (j *Journal) append(rec journalRecord) error {
+	return <-j.enqueue(rec)
+}
+
+// 写入协程：取出所有排队的记录一起写入，只调用一次 Sync
+func (j *Journal) writer() {
+	defer close(j.done)
+
+	for {
+		j.sendMu.Lock()
+		batch, closed := j.pending, j.closed
+		j.pending = nil
+		j.sendMu.Unlock()
+
+		if len(batch) == 0 {
+			if closed {
+				return
+			}
+			<-j.wakeup
+			continue
+		}
+		err := j.writeBatch(batch)
+		for _, w := range batch {
+			j.report(w, err)
+		}
+	}
+}
+
+func (j *Journal) writeBatch(batch []journalWrite) error {
+	var buf []byte
+	for _, w := range batch {
+		data, err := json.Marshal(w.rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(buf); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// 通知写入结果，err 为 nil 表示写入成功
+func (j *Journal) report(w journalWrite, err error) {
+	switch {
+	case w.written != nil:
+		w.written <- err
+	case err != nil && j.onError != nil:
+		j.onError(err)
+	}
+}
+
+// 读取全部记录，忽略进程崩溃时写了一半的最后一行
+func (j *Journal) records() ([]journalRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	file, err := os.Open(j.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []journalRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// 压缩日志：只保留给定的提交记录，写入临时文件后替换原文件
+func (j *Journal) compact(keep []journalRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	tmp := j.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, rec := range keep {
+		if err := enc.Encode(rec); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+
+	// 重新打开替换后的文件用于追加
+	newFile, err := os.OpenFile(j.path, os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	j.file.Close()
+	j.file = newFile
+	return nil
+}
+
+// 设置任务日志，需要在 Start 之前调用
+// 只有通过 SubmitNamed 提交的任务会写入日志
+func (ts *TaskScheduler) SetJournal(journal *Journal) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.journal = journal
+	journal.onError = func(err error) {
+		ts.logf("写入任务日志失败: %v\n", err)
+	}
+}
+
+// 生成日志中使用的任务ID
+func newJournalID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 把提交记录放入写入队列，依赖只能是同样写入日志的任务
+// 不在锁内等待落盘，返回的通道在落盘后收到写入结果
+func (ts *TaskScheduler) journalSubmitLocked(entry *taskEntry) (<-chan error, error) {
+	var deps []string
+	for _, dep := range entry.deps {
+		upstream := ts.entryLocked(dep)
+		if upstream.journalID == "" {
+			return nil, fmt.Errorf("%w: %d", ErrJournalDependency, dep)
+		}
+		deps = append(deps, upstream.journalID)
+	}
+
+	entry.journalID = newJournalID()
+	written := ts.journal.enqueue(journalRecord{
+		Op:        journalSubmit,
+		ID:        entry.journalID,
+		Type:      entry.typeName,
+		Payload:   entry.payload,
+		Name:      entry.name,
+		Priority:  entry.priority,
+		Group:     entry.group,
+		Tenant:    entry.tenant,
+		Key:       entry.key,
+		Deps:      deps,
+		Resources: entry.resources,
+		Retry:     retrySpecOf(entry.retry),
+		Time:      time.Now(),
+	})
+	return written, nil
+}
+
+// 提交开始记录，不等待落盘
+func (ts *TaskScheduler) journalStartLocked(entry *taskEntry) {
+	if ts.journal == nil || entry.journalID == "" {
+		return
+	}
+
+	ts.journal.post(journalRecord{Op: journalStart, ID: entry.journalID, Time: time.Now()})
+}
+
+// 提交结束记录，不等待落盘
+// 因调度器停止而取消或跳过的任务不算结束，重启后会重新执行；
+// 用 CancelTask 取消的任务算作结束，重启后不再执行
+func (ts *TaskScheduler) journalFinishLocked(entry *taskEntry, result TaskResult) {
+	if ts.journal == nil || entry.journalID == "" {
+		return
+	}
+	if result.Status == StatusSkipped || result.Status == StatusCancelled && !errors.Is(result.Error, ErrTaskCancelled) {
+		return
+	}
+
+	rec := journalRecord{
+		Op:     journalFinish,
+		ID:     entry.journalID,
+		Status: result.Status.String(),
+		Time:   time.Now(),
+	}
+	if result.Error != nil {
+		rec.Error = result.Error.Error()
+	}
+	ts.journal.post(rec)
+}
+
+// 提交记录已经写入但任务最终没有提交，补一条取消的结束记录
+func (ts *TaskScheduler) journalAbandonLocked(entry *taskEntry, reason error) {
+	ts.journal.post(journalRecord{
+		Op:     journalFinish,
+		ID:     entry.journalID,
+		Status: StatusCancelled.String(),
+		Error:  reason.Error(),
+		Time:   time.Now(),
+	})
+}
+
+// 重放日志：重新提交没有结束的任务
+func (ts *TaskScheduler) replayJournal() error {
+	records, err := ts.journal.records()
+	if err != nil {
+		return fmt.Errorf("读取任务日志失败: %w", err)
+	}
+
+	// 每个任务最终的状态，没有结束记录的任务需要重新执行
+	var submits []journalRecord
+	finished := make(map[string]string)
+	for _, rec := range records {
+		switch rec.Op {
+		case journalSubmit:
+			submits = append(submits, rec)
+		case journalFinish:
+			finished[rec.ID] = rec.Status
+		}
+	}
+
+	ts.mu.Lock()
+	registry := ts.registry
+	ts.mu.Unlock()
+
+	if registry == nil {
+		return fmt.Errorf("恢复任务日志需要先设置任务注册表")
+	}
+
+	success := StatusSuccess.String()
+	var pending []journalRecord
+	for _, rec := range submits {
+		if _, ok := finished[rec.ID]; ok {
+			continue
+		}
+
+		// 上游已经失败或类型未注册的任务直接记为跳过，不再执行
+		reason := ""
+		for _, dep := range rec.Deps {
+			if status, ok := finished[dep]; ok && status != success {
+				reason = fmt.Sprintf("%v: %s", ErrUpstreamFailed, dep)
+				break
+			}
+		}
+		if _, ok := registry.Lookup(rec.Type); reason == "" && !ok {
+			reason = fmt.Sprintf("%v: %s", ErrUnknownTaskType, rec.Type)
+		}
+		if reason != "" {
+			finished[rec.ID] = StatusSkipped.String()
+			ts.journal.append(journalRecord{
+				Op:     journalFinish,
+				ID:     rec.ID,
+				Status: StatusSkipped.String(),
+				Error:  reason,
+				Time:   time.Now(),
+			})
+			continue
+		}
+		pending = append(pending, rec)
+	}
+
+	if err := ts.journal.compact(pending); err != nil {
+		return fmt.Errorf("压缩任务日志失败: %w", err)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	// 按原提交顺序重新提交，上游一定先于下游提交
+	taskIDs := make(map[string]int)
+	for _, rec := range pending {
+		task, err := ts.registry.NewTask(rec.Type, rec.Payload)
+		if err != nil {
+			return err
+		}
+
+		var deps []int
+		for _, dep := range rec.Deps {
+			// 不在待执行列表中的上游任务已经成功完成
+			if taskID, ok := taskIDs[dep]; ok {
+				deps = append(deps, taskID)
+			}
+		}
+
+		entry, err := ts.newEntryLocked(task, TaskOptions{
+			Name:      rec.Name,
+			Priority:  rec.Priority,
+			Group:     rec.Group,
+			Tenant:    rec.Tenant,
+			Key:       rec.Key,
+			DependsOn: deps,
+			Resources: rec.Resources,
+			Retry:     rec.Retry.policy(),
+		})
+		if err != nil {
+			return err
+		}
+		entry.typeName = rec.Type
+		entry.payload = rec.Payload
+		entry.journalID = rec.ID
+		taskIDs[rec.ID] = ts.submitLocked(entry)
+	}
+
+	if len(pending) > 0 {
+		ts.logf("从日志恢复了 %d 个未完成的任务\n", len(pending))
+	}
+	return nil
+}
+
+func demoJournal() {
+	fmt.Println("演示11：任务日志与重启恢复")
+
+	path := filepath.Join(os.TempDir(), "workOne4_journal.jsonl")
+	os.Remove(path)
+	defer os.Remove(path)
+
+	// 第一次运行：提交 3 个任务，只完成了第一个就停止
+	journal, err := OpenJournal(path)
+	if err != nil {
+		fmt.Printf("打开日志失败: %v\n", err)
+		return
+	}
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetRegistry(NewBuiltinRegistry())
+	scheduler.SetJournal(journal)
+	scheduler.Start()
+
+	for i := 1; i <= 3; i++ {
+		payload := sleepPayload{Message: fmt.Sprintf("导出第 %d 批数据", i), Millis: 200}
+		scheduler.SubmitNamed("sleep", payload, TaskOptions{Name: fmt.Sprintf("导出%d", i)})
+	}
+	time.Sleep(300 * time.Millisecond)
+	fmt.Println("模拟进程重启")
+	scheduler.Stop()
+	journal.Close()
+
+	// 第二次运行：启动时从日志恢复剩下的任务
+	journal, _ = OpenJournal(path)
+	defer journal.Close()
+	scheduler = NewTaskScheduler(1)
+	scheduler.SetRegistry(NewBuiltinRegistry())
+	scheduler.SetJournal(journal)
+	if err := scheduler.Start(); err != nil {
+		fmt.Printf("恢复失败: %v\n", err)
+		return
+	}
+	scheduler.Drain()
+	fmt.Println()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalReplaysResourcesAndRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	claim := Resources{CPU: 2, MemoryMB: 512}
+	retry := RetryPolicy{MaxAttempts: 4, InitialBackoff: 50 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3, Jitter: 0.2}
+
+	// 第一次运行：第一个任务占满资源，第二个任务还没开始就停止
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetRegistry(NewBuiltinRegistry())
+	scheduler.SetJournal(journal)
+	scheduler.SetResourceBudget(claim)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.SubmitNamed("sleep", sleepPayload{Message: "占用", Millis: 300}, TaskOptions{Name: "占用", Resources: claim})
+	scheduler.SubmitNamed("sleep", sleepPayload{Message: "等待"}, TaskOptions{Name: "等待", Resources: claim, Retry: &retry})
+	time.Sleep(50 * time.Millisecond)
+	scheduler.Stop()
+	journal.Close()
+
+	// 第二次运行：恢复的任务仍然带着资源需求和重试策略
+	journal, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	scheduler = NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetRegistry(NewBuiltinRegistry())
+	scheduler.SetJournal(journal)
+	scheduler.SetResourceBudget(claim)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Drain()
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	var replayed *taskEntry
+	for _, entry := range scheduler.tasks {
+		if entry != nil && entry.name == "等待" {
+			replayed = entry
+		}
+	}
+	if replayed == nil {
+		t.Fatal("没有从日志恢复任务")
+	}
+	if replayed.resources != claim {
+		t.Errorf("恢复的任务资源为 %+v，应为 %+v", replayed.resources, claim)
+	}
+	if got := retrySpecOf(replayed.retry); got == nil || *got != *retrySpecOf(&retry) {
+		t.Errorf("恢复的任务重试策略为 %+v，应为 %+v", got, retry)
+	}
+}
+
+func TestSubmitNamedFailsWhenJournalWriteFails(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetRegistry(NewBuiltinRegistry())
+	scheduler.SetJournal(journal)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Drain()
+
+	ok, err := scheduler.SubmitNamed("sleep", sleepPayload{}, TaskOptions{Name: "落盘"})
+	if err != nil {
+		t.Fatalf("提交出错: %v", err)
+	}
+	scheduler.Wait(ok)
+
+	// 日志关闭后无法落盘，提交返回错误，任务不会加入调度器
+	journal.Close()
+	taskID, err := scheduler.SubmitNamed("sleep", sleepPayload{}, TaskOptions{Name: "未落盘"})
+	if !errors.Is(err, ErrJournalClosed) || taskID != -1 {
+		t.Fatalf("日志关闭后提交返回 %d, %v，应为 ErrJournalClosed", taskID, err)
+	}
+	for _, info := range scheduler.Tasks() {
+		if info.Name == "未落盘" {
+			t.Errorf("写入日志失败的任务仍被调度，状态为 %s", info.State)
+		}
+	}
+}
+
+func TestSubmitNamedSchedulesAfterJournalWrite(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetRegistry(NewBuiltinRegistry())
+	scheduler.SetJournal(journal)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Drain()
+
+	// 占住日志文件，模拟写得很慢的磁盘
+	journal.mu.Lock()
+	submitted := make(chan int)
+	go func() {
+		taskID, err := scheduler.SubmitNamed("sleep", sleepPayload{}, TaskOptions{Name: "预写"})
+		if err != nil {
+			t.Error(err)
+		}
+		submitted <- taskID
+	}()
+
+	// 落盘之前任务不会被调度，其他任务照常执行，不会因为等待日志卡住
+	noop, _ := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{})
+	if result, _ := scheduler.Wait(noop); !result.Success {
+		t.Errorf("日志写入慢时其他任务结果为 %s", result.Status)
+	}
+	select {
+	case <-submitted:
+		t.Fatal("提交记录还没落盘 SubmitNamed 就返回了")
+	case <-time.After(20 * time.Millisecond):
+	}
+	for _, info := range scheduler.Tasks() {
+		if info.Name == "预写" {
+			t.Fatalf("提交记录还没落盘任务就进入了调度器，状态为 %s", info.State)
+		}
+	}
+
+	journal.mu.Unlock()
+	if result, _ := scheduler.Wait(<-submitted); !result.Success {
+		t.Errorf("落盘后的任务结果为 %s: %v", result.Status, result.Error)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 指标标签的来源
+type MetricsLabel int
+
+const (
+	LabelByGroup MetricsLabel = iota // 按任务分组，未分组的任务标签为空
+	LabelByName                      // 按任务名称，任务很多时注意标签数量
+)
+
+// 与 Prometheus 客户端默认值相同的直方图分桶，单位为秒
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Prometheus 中使用的任务状态
+var statusLabels = map[TaskStatus]string{
+	StatusSuccess:   "success",
+	StatusFailed:    "failed",
+	StatusTimeout:   "timeout",
+	StatusCancelled: "cancelled",
+	StatusSkipped:   "skipped",
+	StatusPanicked:  "panicked",
+	StatusRejected:  "rejected",
+}
+
+// 直方图
+type histogram struct {
+	counts []uint64 // 每个分桶的数量，不累计
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(defaultBuckets))
+	}
+	for i, bound := range defaultBuckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// 单个标签值下的指标
+type labelMetrics struct {
+	queuedTotal int
+	queued      int
+	running     int
+	finished    map[TaskStatus]int
+	queueWait   histogram
+	admitWait   histogram
+	duration    histogram
+}
+
+// 调度器的 Prometheus 指标，作为观察者收集事件，本身实现了 http.Handler
+type Metrics struct {
+	BaseObserver
+	ts    *TaskScheduler
+	label MetricsLabel
+
+	mu     sync.Mutex
+	byName map[string]*labelMetrics
+}
+
+// 创建指标并注册到调度器
+func NewMetrics(ts *TaskScheduler, label MetricsLabel) *Metrics {
+	m := &Metrics{ts: ts, label: label, byName: make(map[string]*labelMetrics)}
+	ts.AddObserver(m)
+	return m
+}
+
+func (m *Metrics) metricsLocked(name, group string) *labelMetrics {
+	key := group
+	if m.label == LabelByName {
+		key = name
+	}
+	lm, ok := m.byName[key]
+	if !ok {
+		lm = &labelMetrics{finished: make(map[TaskStatus]int)}
+		m.byName[key] = lm
+	}
+	return lm
+}
+
+func (m *Metrics) OnQueued(event TaskEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lm := m.metricsLocked(event.Name, event.Group)
+	lm.queuedTotal++
+	lm.queued++
+}
+
+func (m *Metrics) OnStart(event TaskEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lm := m.metricsLocked(event.Name, event.Group)
+	lm.queued--
+	lm.running++
+}
+
+func (m *Metrics) OnFinish(result TaskResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lm := m.metricsLocked(result.Name, result.Group)
+	lm.finished[result.Status]++
+	// 没有被 worker 取出的任务：跳过的任务没有进入过队列，排队中被取消的任务直接出队
+	if len(result.Attempts) == 0 {
+		if !result.QueuedAt.IsZero() {
+			lm.queued--
+		}
+		return
+	}
+	lm.running--
+	lm.queueWait.observe(result.QueueWait.Seconds())
+	lm.admitWait.observe(result.AdmissionWait.Seconds())
+	lm.duration.observe(result.Duration.Seconds())
+}
+
+// 当前的 worker 数和正在执行任务的 worker 数
+func (ts *TaskScheduler) workerStats() (int, int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.poolSize, ts.busy
+}
+
+// 以 Prometheus 文本格式输出全部指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	pool, busy := m.ts.workerStats()
+	used, budget := m.ts.ResourceUsage()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labelName := "group"
+	if m.label == LabelByName {
+		labelName = "task"
+	}
+	keys := make([]string, 0, len(m.byName))
+	for key := range m.byName {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	label := func(key string) string {
+		return fmt.Sprintf("%s=\"%s\"", labelName, escapeLabel(key))
+	}
+
+	writeHeader(&b, "taskscheduler_tasks_queued_total", "counter", "进入就绪队列的任务数")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "taskscheduler_tasks_queued_total{%s} %d\n", label(key), m.byName[key].queuedTotal)
+	}
+
+	writeHeader(&b, "taskscheduler_tasks_queued", "gauge", "正在排队的任务数")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "taskscheduler_tasks_queued{%s} %d\n", label(key), m.byName[key].queued)
+	}
+
+	writeHeader(&b, "taskscheduler_tasks_running", "gauge", "正在执行的任务数")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "taskscheduler_tasks_running{%s} %d\n", label(key), m.byName[key].running)
+	}
+
+	writeHeader(&b, "taskscheduler_tasks_finished_total", "counter", "按状态统计的已结束任务数")
+	for _, key := range keys {
+		lm := m.byName[key]
+		for _, status := range []TaskStatus{StatusSuccess, StatusFailed, StatusTimeout, StatusCancelled, StatusSkipped, StatusPanicked, StatusRejected} {
+			fmt.Fprintf(&b, "taskscheduler_tasks_finished_total{%s,status=%q} %d\n", label(key), statusLabels[status], lm.finished[status])
+		}
+	}
+
+	writeHeader(&b, "taskscheduler_task_queue_wait_seconds", "histogram", "任务在队列中的等待时间")
+	for _, key := range keys {
+		writeHistogram(&b, "taskscheduler_task_queue_wait_seconds", label(key), &m.byName[key].queueWait)
+	}
+
+	writeHeader(&b, "taskscheduler_task_admission_wait_seconds", "histogram", "任务因资源预算不足等待的时间")
+	for _, key := range keys {
+		writeHistogram(&b, "taskscheduler_task_admission_wait_seconds", label(key), &m.byName[key].admitWait)
+	}
+
+	writeHeader(&b, "taskscheduler_task_duration_seconds", "histogram", "任务执行时间，包括重试")
+	for _, key := range keys {
+		writeHistogram(&b, "taskscheduler_task_duration_seconds", label(key), &m.byName[key].duration)
+	}
+
+	utilization := 0.0
+	if pool > 0 {
+		utilization = float64(busy) / float64(pool)
+	}
+	writeHeader(&b, "taskscheduler_workers", "gauge", "当前的 worker 数")
+	fmt.Fprintf(&b, "taskscheduler_workers %d\n", pool)
+	writeHeader(&b, "taskscheduler_workers_busy", "gauge", "正在执行任务的 worker 数")
+	fmt.Fprintf(&b, "taskscheduler_workers_busy %d\n", busy)
+	writeHeader(&b, "taskscheduler_worker_utilization", "gauge", "忙碌的 worker 占比")
+	fmt.Fprintf(&b, "taskscheduler_worker_utilization %g\n", utilization)
+
+	writeHeader(&b, "taskscheduler_resource_used", "gauge", "正在执行的任务占用的资源")
+	fmt.Fprintf(&b, "taskscheduler_resource_used{resource=\"cpu\"} %d\n", used.CPU)
+	fmt.Fprintf(&b, "taskscheduler_resource_used{resource=\"memory_mb\"} %d\n", used.MemoryMB)
+	writeHeader(&b, "taskscheduler_resource_budget", "gauge", "资源预算，0 表示不限制")
+	fmt.Fprintf(&b, "taskscheduler_resource_budget{resource=\"cpu\"} %d\n", budget.CPU)
+	fmt.Fprintf(&b, "taskscheduler_resource_budget{resource=\"memory_mb\"} %d\n", budget.MemoryMB)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// 实现 http.Handler，可以直接挂到 /metrics
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(b *strings.Builder, name, label string, h *histogram) {
+	var cumulative uint64
+	for i, bound := range defaultBuckets {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"%g\"} %d\n", name, label, bound, cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, label, h.count)
+	fmt.Fprintf(b, "%s_sum{%s} %g\n", name, label, h.sum)
+	fmt.Fprintf(b, "%s_count{%s} %d\n", name, label, h.count)
+}
+
+// 标签值需要转义反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// 在本机随机端口上提供 HTTP 服务，返回访问地址和关闭函数，供演示使用
+func serveLocal(handler http.Handler) (url string, stop func(), err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	return "http://" + listener.Addr().String(), func() { server.Close() }, nil
+}
+
+func demoMetrics() {
+	fmt.Println("演示16：Prometheus 指标")
+
+	scheduler := NewTaskScheduler(3)
+	scheduler.SetQuiet(true)
+	metrics := NewMetrics(scheduler, LabelByGroup)
+	scheduler.Start()
+
+	// 本地启动一个 HTTP 服务暴露指标，不需要外部服务
+	url, stop, err := serveLocal(metrics)
+	if err != nil {
+		fmt.Printf("启动 HTTP 服务失败: %v\n\n", err)
+		return
+	}
+	defer stop()
+
+	for i := 0; i < 6; i++ {
+		group := "api"
+		if i%2 == 1 {
+			group = "batch"
+		}
+		var err error
+		if i == 5 {
+			err = errBadRequest
+		}
+		name := fmt.Sprintf("%s-%d", group, i+1)
+		scheduler.Submit(sleepStep(name, time.Duration(20+i*10)*time.Millisecond, err), TaskOptions{Name: name, Group: group})
+	}
+
+	// 抓取指标，只展示部分内容
+	scrape := func(prefixes ...string) {
+		resp, err := http.Get(url)
+		if err != nil {
+			fmt.Printf("获取指标失败: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		for _, line := range strings.Split(string(body), "\n") {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(line, prefix) && !strings.HasSuffix(line, " 0") {
+					fmt.Println(line)
+					break
+				}
+			}
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	fmt.Println("运行中:")
+	scrape("taskscheduler_tasks_queued{", "taskscheduler_tasks_running", "taskscheduler_worker")
+
+	scheduler.Drain()
+	fmt.Println("全部结束后:")
+	scrape("taskscheduler_tasks_finished_total", "taskscheduler_task_duration_seconds_count", "taskscheduler_task_queue_wait_seconds_sum")
+	fmt.Println()
+}
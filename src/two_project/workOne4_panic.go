@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// 任务 panic 时返回的错误，保存 panic 的值和发生时的堆栈
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func newPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("任务崩溃: %v", e.Value)
+}
+
+// panic 的值本身是 error 时，允许用 errors.Is/As 继续匹配
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// 设置任务 panic 后是否重新抛出；默认捕获 panic 并记为失败，
+// 开启后任何任务 panic 都会让进程立即退出
+func (ts *TaskScheduler) SetRepanic(repanic bool) {
+	ts.repanic = repanic
+}
+
+// 执行任务并把 panic 转换为 *PanicError
+func safeCall(ctx context.Context, task ContextTask) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// Join 重新抛出的子任务 panic 保留子任务的堆栈
+			if pe, ok := r.(*PanicError); ok {
+				err = pe
+				return
+			}
+			err = newPanicError(r)
+		}
+	}()
+	return task(ctx)
+}
+
+func demoPanicIsolation() {
+	fmt.Println("演示10：任务 panic 隔离")
+
+	scheduler := NewTaskScheduler(3)
+	scheduler.AddTaskWithOptions(sleepStep("正常任务", 100*time.Millisecond, nil), TaskOptions{Name: "正常任务"})
+	scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+		var m map[string]int
+		m["key"] = 1 // 向 nil map 写入会 panic
+		return nil
+	}, TaskOptions{Name: "空 map 任务"})
+	// 旧接口的任务同样会被隔离
+	scheduler.AddTask(func() error {
+		panic("配置文件损坏")
+	})
+	scheduler.RunParallel()
+
+	for _, result := range scheduler.GetResults() {
+		if result.Panic == nil {
+			continue
+		}
+		// 只打印 panic 发生位置附近的堆栈
+		stack := string(result.Panic.Stack)
+		if i := strings.Index(stack, "\npanic("); i >= 0 {
+			stack = stack[i+1:]
+		}
+		lines := strings.SplitN(stack, "\n", 6)
+		fmt.Printf("任务 %d 的 panic: %v\n%s\n\n", result.TaskID+1, result.Panic.Value, strings.Join(lines[:len(lines)-1], "\n"))
+	}
+}
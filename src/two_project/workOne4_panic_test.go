@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanicIsRecoveredIntoResult(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Minute} {
+		scheduler := NewTaskScheduler(1)
+		scheduler.SetQuiet(true)
+		scheduler.SetTimeout(timeout)
+		broken, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+			var m map[string]int
+			m["key"] = 1
+			return nil
+		}, TaskOptions{Name: "空 map"})
+		legacy, _ := scheduler.AddTaskWithOptions(AdaptTask(func() error { panic(io.ErrUnexpectedEOF) }), TaskOptions{})
+		// 只有一个 worker，panic 之后它仍然继续执行后面的任务
+		after, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error { return nil }, TaskOptions{})
+		scheduler.RunParallel()
+
+		results := scheduler.GetResults()
+		r := results[broken]
+		if r.Status != StatusPanicked || r.Success || r.Panic == nil {
+			t.Fatalf("超时 %v: panic 的任务状态为 %s，Panic 为 %v", timeout, r.Status, r.Panic)
+		}
+		if !strings.Contains(string(r.Panic.Stack), "TestPanicIsRecoveredIntoResult") {
+			t.Errorf("超时 %v: 堆栈中没有发生 panic 的函数:\n%s", timeout, r.Panic.Stack)
+		}
+		// panic 的值是 error 时仍可以用 errors.Is 匹配
+		if r := results[legacy]; r.Status != StatusPanicked || !errors.Is(r.Error, io.ErrUnexpectedEOF) {
+			t.Errorf("超时 %v: 旧接口任务状态为 %s，错误为 %v", timeout, r.Status, r.Error)
+		}
+		if r := results[after]; r.Status != StatusSuccess {
+			t.Errorf("超时 %v: panic 之后的任务状态为 %s，应为成功", timeout, r.Status)
+		}
+	}
+}
+
+func TestPanicIsNotRetried(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetRetryPolicy(RetryPolicy{MaxAttempts: 3})
+	calls := 0
+	scheduler.AddContextTask(func(ctx context.Context) error {
+		calls++
+		panic("每次都会出错")
+	})
+	scheduler.RunSerial()
+
+	if r := scheduler.GetResults()[0]; r.Status != StatusPanicked || calls != 1 {
+		t.Errorf("panic 的任务状态为 %s，执行了 %d 次", r.Status, calls)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 并行处理的选项
+type ParallelOptions struct {
+	Concurrency int         // 同时提交的最大项数，0 表示与调度器的 worker 数相同
+	CollectAll  bool        // 收集所有项的错误；默认遇到第一个错误就取消剩下的项
+	Task        TaskOptions // 每一项任务的选项，Name 作为任务名前缀
+}
+
+// 并行处理中某一项的错误
+type ItemError struct {
+	Index int // 出错项在输入中的下标
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("第 %d 项: %v", e.Index+1, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// 对每一项并行执行 fn，按输入顺序返回结果，出错的项为零值
+// 调度器需要已经以服务模式启动，每一项作为一个任务提交，重试、超时和限流与普通任务相同
+// ctx 被取消时不再提交新的项，已提交的项通过 CancelTask 取消
+func ParallelMap[T, R any](ctx context.Context, ts *TaskScheduler, items []T, fn func(ctx context.Context, item T) (R, error), opts ...ParallelOptions) ([]R, error) {
+	values, _, err := parallelRun(ctx, ts, items, fn, opts)
+	return values, err
+}
+
+// 并行判断每一项，按输入顺序返回 keep 为 true 的项
+func ParallelFilter[T any](ctx context.Context, ts *TaskScheduler, items []T, keep func(ctx context.Context, item T) (bool, error), opts ...ParallelOptions) ([]T, error) {
+	flags, err := ParallelMap(ctx, ts, items, keep, opts...)
+
+	var kept []T
+	for i, ok := range flags {
+		if ok {
+			kept = append(kept, items[i])
+		}
+	}
+	return kept, err
+}
+
+// 对每一项并行执行 fn，再在调用方协程中按输入顺序用 combine 合并，combine 不需要满足交换律
+// 有错误时只合并成功的项
+func ParallelReduce[T, R, A any](ctx context.Context, ts *TaskScheduler, items []T, fn func(ctx context.Context, item T) (R, error), initial A, combine func(acc A, value R) A, opts ...ParallelOptions) (A, error) {
+	values, ok, err := parallelRun(ctx, ts, items, fn, opts)
+
+	acc := initial
+	for i, v := range values {
+		if ok[i] {
+			acc = combine(acc, v)
+		}
+	}
+	return acc, err
+}
+
+// 提交并等待所有项，返回结果、每一项是否成功和合并后的错误
+func parallelRun[T, R any](ctx context.Context, ts *TaskScheduler, items []T, fn func(ctx context.Context, item T) (R, error), opts []ParallelOptions) ([]R, []bool, error) {
+	var opt ParallelOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Concurrency <= 0 {
+		ts.mu.Lock()
+		opt.Concurrency = max(ts.maxWorkers, 1)
+		ts.mu.Unlock()
+	}
+	prefix := opt.Task.Name
+	if prefix == "" {
+		prefix = "并行"
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	values := make([]R, len(items))
+	ok := make([]bool, len(items))
+	errs := make([]error, len(items))
+	slots := make(chan struct{}, opt.Concurrency)
+
+	var (
+		mu         sync.Mutex
+		first      error
+		incomplete bool // 有项因为取消没有执行完
+		wg         sync.WaitGroup
+	)
+
+submit:
+	for i, item := range items {
+		select {
+		case slots <- struct{}{}:
+		case <-runCtx.Done():
+		}
+		// 名额和取消同时就绪时 select 随机选择，取消后不再提交
+		if runCtx.Err() != nil {
+			mu.Lock()
+			incomplete = true
+			mu.Unlock()
+			break submit
+		}
+
+		taskOpts := opt.Task
+		taskOpts.Name = fmt.Sprintf("%s %d/%d", prefix, i+1, len(items))
+		f := Submit(ts, func(taskCtx context.Context) (R, error) {
+			return fn(taskCtx, item)
+		}, taskOpts)
+		stop := context.AfterFunc(runCtx, func() { ts.CancelTask(f.TaskID()) })
+
+		wg.Add(1)
+		f.OnComplete(func(r TypedResult[R]) {
+			defer wg.Done()
+			// 记录结果（出错时取消剩下的项）之后再归还名额，出错后不会再提交新的项
+			defer func() { <-slots }()
+			stop()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if r.Success {
+				values[i], ok[i] = r.Value, true
+				return
+			}
+			// 因为其他项出错或 ctx 被取消而取消的项不算错误
+			if runCtx.Err() != nil && errors.Is(r.Error, ErrTaskCancelled) {
+				incomplete = true
+				return
+			}
+			errs[i] = &ItemError{Index: i, Err: r.Error}
+			if first == nil {
+				first = errs[i]
+			}
+			if !opt.CollectAll {
+				cancel()
+			}
+		})
+
+		// 提交失败说明调度器没有运行，后面的项也无法提交
+		if f.TaskID() < 0 {
+			break
+		}
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !opt.CollectAll {
+		if first == nil && incomplete {
+			first = context.Cause(ctx)
+		}
+		return values, ok, first
+	}
+	var all []error
+	for _, err := range errs {
+		if err != nil {
+			all = append(all, err)
+		}
+	}
+	if incomplete && ctx.Err() != nil {
+		all = append(all, context.Cause(ctx))
+	}
+	return values, ok, errors.Join(all...)
+}
+
+func demoParallelHelpers() {
+	fmt.Println("演示27：并行 map/filter/reduce")
+
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetQuiet(true)
+	scheduler.Start()
+	defer scheduler.Drain()
+	ctx := context.Background()
+
+	words := strings.Fields("调度 任务 重试 超时 限流 熔断 依赖 优先级 租户 模拟")
+
+	// map：结果顺序与输入相同，与完成顺序无关
+	lengths, err := ParallelMap(ctx, scheduler, words, func(ctx context.Context, w string) (int, error) {
+		if !sleepContext(ctx, time.Duration(len(words)-len([]rune(w)))*10*time.Millisecond) {
+			return 0, ctx.Err()
+		}
+		return len([]rune(w)), nil
+	}, ParallelOptions{Task: TaskOptions{Name: "长度"}})
+	fmt.Printf("各词长度: %v，错误: %v\n", lengths, err)
+
+	// filter：保留两个字的词
+	short, err := ParallelFilter(ctx, scheduler, words, func(ctx context.Context, w string) (bool, error) {
+		return len([]rune(w)) == 2, nil
+	})
+	fmt.Printf("两个字的词: %v，错误: %v\n", short, err)
+
+	// reduce：按输入顺序拼接，最多同时执行 2 项
+	joined, err := ParallelReduce(ctx, scheduler, words, func(ctx context.Context, w string) (string, error) {
+		return "[" + w + "]", nil
+	}, "", func(acc, s string) string { return acc + s }, ParallelOptions{Concurrency: 2})
+	fmt.Printf("拼接: %s，错误: %v\n", joined, err)
+
+	// 第 3 项和第 6 项会失败
+	check := func(ctx context.Context, n int) (int, error) {
+		if n%3 == 0 {
+			return 0, fmt.Errorf("%d 不合法", n)
+		}
+		if !sleepContext(ctx, 50*time.Millisecond) {
+			return 0, ctx.Err()
+		}
+		return n * n, nil
+	}
+	numbers := []int{1, 2, 3, 4, 5, 6, 7, 8}
+
+	squares, err := ParallelMap(ctx, scheduler, numbers, check, ParallelOptions{Concurrency: 2})
+	fmt.Printf("遇到第一个错误即停止: %v，错误: %v\n", squares, err)
+
+	squares, err = ParallelMap(ctx, scheduler, numbers, check, ParallelOptions{Concurrency: 2, CollectAll: true})
+	fmt.Printf("收集所有错误: %v，错误: %v\n", squares, strings.ReplaceAll(fmt.Sprint(err), "\n", "；"))
+
+	var itemErr *ItemError
+	if errors.As(err, &itemErr) {
+		fmt.Printf("第一个出错项的下标: %d\n", itemErr.Index)
+	}
+
+	// 取消：100ms 后取消，已经提交的项被取消，剩下的项不再提交
+	cancelCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	sum, err := ParallelReduce(cancelCtx, scheduler, numbers, func(ctx context.Context, n int) (int, error) {
+		if !sleepContext(ctx, 80*time.Millisecond) {
+			return 0, ctx.Err()
+		}
+		return n, nil
+	}, 0, func(acc, n int) int { return acc + n }, ParallelOptions{Concurrency: 2})
+	fmt.Printf("取消前完成的项之和: %d，错误: %v\n\n", sum, err)
+}
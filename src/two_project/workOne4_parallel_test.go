@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func startParallelScheduler(t *testing.T, workers int) *TaskScheduler {
+	t.Helper()
+
+	scheduler := NewTaskScheduler(workers)
+	scheduler.SetQuiet(true)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(scheduler.Drain)
+	return scheduler
+}
+
+func TestParallelHelpersKeepInputOrder(t *testing.T) {
+	scheduler := startParallelScheduler(t, 4)
+	ctx := context.Background()
+	items := []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+	// 后面的项先完成，结果仍按输入顺序；同时执行的项不超过 Concurrency
+	var active, peak atomic.Int32
+	squares, err := ParallelMap(ctx, scheduler, items, func(ctx context.Context, n int) (int, error) {
+		cur := active.Add(1)
+		for p := peak.Load(); cur > p && !peak.CompareAndSwap(p, cur); p = peak.Load() {
+		}
+		time.Sleep(time.Duration(len(items)-n) * time.Millisecond)
+		active.Add(-1)
+		return n * n, nil
+	}, ParallelOptions{Concurrency: 3})
+	if err != nil || fmt.Sprint(squares) != "[0 1 4 9 16 25 36 49]" {
+		t.Errorf("ParallelMap 返回 %v %v", squares, err)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("同时执行了 %d 项，超过 Concurrency 3", p)
+	}
+
+	even, err := ParallelFilter(ctx, scheduler, items, func(ctx context.Context, n int) (bool, error) {
+		return n%2 == 0, nil
+	})
+	if err != nil || fmt.Sprint(even) != "[0 2 4 6]" {
+		t.Errorf("ParallelFilter 返回 %v %v", even, err)
+	}
+
+	// 拼接不满足交换律，结果说明按输入顺序合并
+	joined, err := ParallelReduce(ctx, scheduler, items, func(ctx context.Context, n int) (string, error) {
+		return fmt.Sprint(n), nil
+	}, "", func(acc, s string) string { return acc + s })
+	if err != nil || joined != "01234567" {
+		t.Errorf("ParallelReduce 返回 %q %v", joined, err)
+	}
+}
+
+func TestParallelMapStopsAtFirstError(t *testing.T) {
+	scheduler := startParallelScheduler(t, 4)
+	var calls atomic.Int32
+	_, err := ParallelMap(context.Background(), scheduler, make([]int, 20), func(ctx context.Context, _ int) (int, error) {
+		if calls.Add(1) == 2 {
+			return 0, errors.New("坏数据")
+		}
+		// 其他项一直等到被取消
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}, ParallelOptions{Concurrency: 2})
+
+	// 只返回第一个错误，被它取消的项不算错误，剩下的项不再提交
+	var itemErr *ItemError
+	if !errors.As(err, &itemErr) || itemErr.Err.Error() != "坏数据" || strings.Count(err.Error(), "第") != 1 {
+		t.Errorf("返回的错误为 %v，应只有出错的那一项", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("执行了 %d 项，出错后不应再提交新的项", n)
+	}
+}
+
+func TestParallelCollectAll(t *testing.T) {
+	scheduler := startParallelScheduler(t, 2)
+	items := []int{1, 2, 3, 4, 5, 6}
+	fn := func(ctx context.Context, n int) (int, error) {
+		if n%3 == 0 {
+			return 0, fmt.Errorf("%d 不能被处理", n)
+		}
+		return n, nil
+	}
+
+	values, err := ParallelMap(context.Background(), scheduler, items, fn, ParallelOptions{CollectAll: true})
+	if fmt.Sprint(values) != "[1 2 0 4 5 0]" {
+		t.Errorf("出错的项应为零值，其他项照常返回: %v", values)
+	}
+	if err == nil || err.Error() != "第 3 项: 3 不能被处理\n第 6 项: 6 不能被处理" {
+		t.Errorf("CollectAll 返回的错误为 %q，应按顺序包含第 3 项和第 6 项", err)
+	}
+
+	// reduce 只合并成功的项
+	sum, err := ParallelReduce(context.Background(), scheduler, items, fn, 0, func(acc, n int) int { return acc + n }, ParallelOptions{CollectAll: true})
+	if sum != 12 || err == nil {
+		t.Errorf("ParallelReduce 返回 %d %v，应为成功项之和 12 和错误", sum, err)
+	}
+}
+
+func TestParallelMapCancelled(t *testing.T) {
+	scheduler := startParallelScheduler(t, 2)
+	cause := errors.New("用户取消")
+	for _, collectAll := range []bool{false, true} {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		var calls atomic.Int32
+		_, err := ParallelMap(ctx, scheduler, make([]int, 10), func(taskCtx context.Context, _ int) (int, error) {
+			if calls.Add(1) == 2 {
+				cancel(cause)
+			}
+			<-taskCtx.Done()
+			return 0, taskCtx.Err()
+		}, ParallelOptions{Concurrency: 2, CollectAll: collectAll})
+
+		// 被取消的项不算错误，返回取消的原因，剩下的项不再提交
+		var itemErr *ItemError
+		if !errors.Is(err, cause) || errors.As(err, &itemErr) {
+			t.Errorf("CollectAll=%v: 取消后返回 %v，应为取消的原因", collectAll, err)
+		}
+		if n := calls.Load(); n > 2 {
+			t.Errorf("CollectAll=%v: 取消后仍执行了 %d 项", collectAll, n)
+		}
+		cancel(nil)
+	}
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 队列中等待执行的任务
+type queuedTask struct {
+	taskID     int
+	entry      *taskEntry
+	priority   int
+	enqueuedAt time.Time
+	seq        int64   // 入队顺序，优先级相同时先入先出
+	score      float64 // 排序键，越大越先执行
+
+	retryAt        time.Time // 被限流时可以重新检查的时间
+	throttledAt    time.Time // 第一次因为限流没能出队的时间
+	holdsGroup     bool      // 是否占用了分组的并发名额
+	admitWaitFrom  time.Time // 第一次因为资源不足没能出队的时间
+	resources      Resources // 实际占用的资源
+	holdsResources bool
+}
+
+// 出队前的准入检查，不允许时返回可以重试的时间（零值表示等待唤醒）
+type admitFunc func(item *queuedTask) (bool, time.Time)
+
+// 按 score 排序的最大堆
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x any) { *h = append(*h, x.(*queuedTask)) }
+
+func (h *taskHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// 被限流的任务，按可以重新检查的时间排序的最小堆
+type parkedHeap []*queuedTask
+
+func (h parkedHeap) Len() int { return len(h) }
+
+func (h parkedHeap) Less(i, j int) bool {
+	if !h[i].retryAt.Equal(h[j].retryAt) {
+		return h[i].retryAt.Before(h[j].retryAt)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h parkedHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *parkedHeap) Push(x any) { *h = append(*h, x.(*queuedTask)) }
+
+func (h *parkedHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// 优先级就绪队列，worker 总是取出当前优先级最高的任务
+//
+// 开启老化后，任务每等待 aging 时间优先级提升 1，避免低优先级任务饿死。
+// 有效优先级 = priority + (now-enqueuedAt)/aging，其中 now 对所有任务相同，
+// 因此排序只依赖 priority - enqueuedAt/aging，入队时即可算出。
+//
+// 每个租户有自己的队列，先按加权公平排队选出租户，再在租户内按优先级取任务，
+// 优先级只在同一租户内比较。
+//
+// 没通过准入检查的任务移出租户的队列，不再在每次出队时重复检查：
+// 知道重试时间的（分组限速）放在 parked 中到时间后放回，
+// 等待其他任务释放名额或资源的放在 blocked 中，直到有任务结束或设置变化时放回。
+type readyQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	clock   Clock
+	tenants map[string]*tenantQueue
+	fair    tenantHeap    // 有可出队任务的租户
+	parked  parkedHeap    // 等到 retryAt 再检查的任务
+	blocked []*queuedTask // 等待名额或资源的任务
+	size    int           // 所有租户排队的任务数，包括被限流的
+	aging   time.Duration
+	base    time.Time
+	seq     int64
+	closed  bool
+	done    chan struct{} // 队列关闭时关闭
+	wakeAt  time.Time     // 已安排的定时唤醒时间
+	retire  int           // 等待退出的空闲 worker 数，缩容时使用
+
+	forkWork func() bool  // 是否有排队的 Fork 子任务，nil 表示没有子任务队列
+	idle     atomic.Int32 // 阻塞等待的 worker 数
+}
+
+func newReadyQueue(clock Clock, aging time.Duration, weights map[string]float64) *readyQueue {
+	q := &readyQueue{
+		clock:   clock,
+		tenants: make(map[string]*tenantQueue),
+		aging:   aging,
+		base:    clock.Now(),
+		done:    make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for tenant, weight := range weights {
+		q.tenantLocked(tenant).weight = weight
+	}
+	return q
+}
+
+func (q *readyQueue) tenantLocked(tenant string) *tenantQueue {
+	t, ok := q.tenants[tenant]
+	if !ok {
+		t = &tenantQueue{name: tenant, weight: 1, index: -1}
+		q.tenants[tenant] = t
+	}
+	return t
+}
+
+// 任务入队
+func (q *readyQueue) push(taskID int, entry *taskEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.clock.Now()
+	priority := entry.priority
+	score := float64(priority)
+	if q.aging > 0 {
+		score -= float64(now.Sub(q.base)) / float64(q.aging)
+	}
+
+	t := q.tenantLocked(entry.tenant)
+	if t.queued() == 0 {
+		t.activateLocked(q)
+	}
+	q.seq++
+	q.size++
+	q.readyLocked(t, &queuedTask{
+		taskID:     taskID,
+		entry:      entry,
+		priority:   priority,
+		enqueuedAt: now,
+		seq:        q.seq,
+		score:      score,
+	})
+	t.peak = max(t.peak, t.queued())
+	q.cond.Signal()
+}
+
+// 把任务放入租户的可出队任务中
+func (q *readyQueue) readyLocked(t *tenantQueue, item *queuedTask) {
+	heap.Push(&t.items, item)
+	if t.index < 0 {
+		heap.Push(&q.fair, t)
+	}
+}
+
+// 把没通过准入检查的任务移出租户的队列，at 为零值表示等待名额或资源
+func (q *readyQueue) parkLocked(t *tenantQueue, item *queuedTask, at time.Time) {
+	t.parked++
+	if at.IsZero() {
+		q.blocked = append(q.blocked, item)
+		return
+	}
+	item.retryAt = at
+	heap.Push(&q.parked, item)
+}
+
+func (q *readyQueue) unparkLocked(item *queuedTask) {
+	t := q.tenantLocked(item.entry.tenant)
+	t.parked--
+	q.readyLocked(t, item)
+}
+
+// 放回已到重试时间的任务
+func (q *readyQueue) unparkDueLocked(now time.Time) {
+	for len(q.parked) > 0 && !q.parked[0].retryAt.After(now) {
+		q.unparkLocked(heap.Pop(&q.parked).(*queuedTask))
+	}
+}
+
+// 放回等待名额或资源的任务
+func (q *readyQueue) unparkBlockedLocked() {
+	for _, item := range q.blocked {
+		q.unparkLocked(item)
+	}
+	q.blocked = nil
+}
+
+// 取出通过准入检查的优先级最高的任务，没有时阻塞，队列关闭后返回 false
+// 没有就绪任务但有排队的 Fork 子任务时返回 nil 和 true，由 worker 去执行子任务
+func (q *readyQueue) pop(admit admitFunc) (*queuedTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.retire > 0 {
+			q.retire--
+			return nil, false
+		}
+		if q.size == 0 && q.closed {
+			return nil, false
+		}
+
+		item, retryAt := q.popLocked(admit)
+		if item != nil {
+			return item, true
+		}
+		if !retryAt.IsZero() {
+			q.scheduleWake(retryAt)
+		}
+		// 先登记为空闲再检查子任务，提交子任务时看到空闲的 worker 就会唤醒，不会错过
+		q.idle.Add(1)
+		if q.forkWork != nil && q.forkWork() {
+			q.idle.Add(-1)
+			return nil, true
+		}
+		q.cond.Wait()
+		q.idle.Add(-1)
+	}
+}
+
+// 取出通过准入检查的任务，不阻塞；没有时返回可以重试的时间（零值表示等待其他任务结束）
+func (q *readyQueue) tryPop(admit admitFunc) (*queuedTask, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.popLocked(admit)
+}
+
+// 按公平顺序选出租户，租户内按优先级检查，没通过准入检查的任务移出队列
+// 没有可出队的任务时返回最早的重试时间
+func (q *readyQueue) popLocked(admit admitFunc) (*queuedTask, time.Time) {
+	q.unparkDueLocked(q.clock.Now())
+
+	for len(q.fair) > 0 {
+		t := q.fair[0]
+		item := heap.Pop(&t.items).(*queuedTask)
+		if len(t.items) == 0 {
+			heap.Pop(&q.fair)
+		}
+
+		ok, at := true, time.Time{}
+		if admit != nil {
+			ok, at = admit(item)
+		}
+		if !ok {
+			q.parkLocked(t, item, at)
+			continue
+		}
+		q.size--
+		t.dispatchLocked()
+		q.fixTenantLocked(t)
+		return item, time.Time{}
+	}
+
+	if len(q.parked) > 0 {
+		return nil, q.parked[0].retryAt
+	}
+	return nil, time.Time{}
+}
+
+// 在指定时间唤醒等待的 worker，已有更早的唤醒时不重复安排
+func (q *readyQueue) scheduleWake(at time.Time) {
+	now := q.clock.Now()
+	if !q.wakeAt.IsZero() && !q.wakeAt.After(at) && q.wakeAt.After(now) {
+		return
+	}
+	q.wakeAt = at
+	timer := q.clock.NewTimer(at.Sub(now))
+	go func() {
+		select {
+		case <-timer.C():
+			q.broadcast()
+		case <-q.done:
+			timer.Stop()
+		}
+	}()
+}
+
+// 设置变化或取消时，放回所有被限流的任务，唤醒所有等待的 worker 重新检查
+func (q *readyQueue) wake() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.unparkBlockedLocked()
+	for len(q.parked) > 0 {
+		q.unparkLocked(heap.Pop(&q.parked).(*queuedTask))
+	}
+	q.cond.Broadcast()
+}
+
+// 有任务释放了名额或资源，放回等待名额或资源的任务
+func (q *readyQueue) wakeBlocked() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.unparkBlockedLocked()
+	q.cond.Broadcast()
+}
+
+// 提交了 Fork 子任务，有空闲的 worker 时唤醒一个来执行
+func (q *readyQueue) wakeIdle() {
+	if q.idle.Load() == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.cond.Signal()
+	q.mu.Unlock()
+}
+
+// 唤醒所有等待的 worker，到期的任务在出队时放回
+func (q *readyQueue) broadcast() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.cond.Broadcast()
+}
+
+// 从队列中移除任务，任务不在队列中（例如已被 worker 取出）时返回 nil
+func (q *readyQueue) remove(taskID int) *queuedTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, t := range q.tenants {
+		for i, item := range t.items {
+			if item.taskID == taskID {
+				heap.Remove(&t.items, i)
+				if len(t.items) == 0 {
+					heap.Remove(&q.fair, t.index)
+				}
+				q.size--
+				return item
+			}
+		}
+	}
+	for i, item := range q.parked {
+		if item.taskID == taskID {
+			heap.Remove(&q.parked, i)
+			q.tenantLocked(item.entry.tenant).parked--
+			q.size--
+			return item
+		}
+	}
+	for i, item := range q.blocked {
+		if item.taskID == taskID {
+			q.blocked = append(q.blocked[:i], q.blocked[i+1:]...)
+			q.tenantLocked(item.entry.tenant).parked--
+			q.size--
+			return item
+		}
+	}
+	return nil
+}
+
+// 队列中的任务数
+func (q *readyQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.size
+}
+
+// 队列长度和最早入队任务的时间
+func (q *readyQueue) stats() (int, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var oldest time.Time
+	check := func(items []*queuedTask) {
+		for _, item := range items {
+			if oldest.IsZero() || item.enqueuedAt.Before(oldest) {
+				oldest = item.enqueuedAt
+			}
+		}
+	}
+	for _, t := range q.tenants {
+		check(t.items)
+	}
+	check(q.parked)
+	check(q.blocked)
+	return q.size, oldest
+}
+
+// 让 n 个 worker 在下次取任务时退出
+func (q *readyQueue) retireWorkers(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.retire += n
+	q.cond.Broadcast()
+}
+
+// 队列是否已关闭
+func (q *readyQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.closed
+}
+
+// 关闭队列，唤醒所有等待的 worker
+func (q *readyQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+	q.cond.Broadcast()
+}
+
+// 设置优先级老化间隔，任务每等待 interval 优先级提升 1，0 表示不老化
+func (ts *TaskScheduler) SetAging(interval time.Duration) {
+	ts.aging = interval
+}
+
+func demoPriority() {
+	fmt.Println("演示7：按优先级调度")
+
+	// 单个 worker，便于观察执行顺序
+	scheduler := NewTaskScheduler(1)
+
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("批量任务%d", i+1)
+		scheduler.AddTaskWithOptions(sleepStep(name, 100*time.Millisecond, nil), TaskOptions{Name: name})
+	}
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("紧急任务%d", i+1)
+		scheduler.AddTaskWithOptions(sleepStep(name, 100*time.Millisecond, nil), TaskOptions{Name: name, Priority: 10})
+	}
+	scheduler.RunParallel()
+
+	fmt.Println("开启老化后，等待足够久的低优先级任务会被提前执行")
+	scheduler = NewTaskScheduler(1)
+	scheduler.SetAging(50 * time.Millisecond)
+
+	scheduler.AddTaskWithOptions(sleepStep("低优先级任务", 100*time.Millisecond, nil), TaskOptions{Name: "低优先级任务"})
+	// 中优先级任务串成依赖链，后面的任务要等前一个完成才入队
+	prev := -1
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("中优先级任务%d", i+1)
+		opts := TaskOptions{Name: name, Priority: 3}
+		if prev >= 0 {
+			opts.DependsOn = []int{prev}
+		}
+		prev, _ = scheduler.AddTaskWithOptions(sleepStep(name, 100*time.Millisecond, nil), opts)
+	}
+	scheduler.RunParallel()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueueParksThrottledItemsUntilRetryAt(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	q := newReadyQueue(clock, 0, nil)
+	for i := 0; i < 100; i++ {
+		q.push(i, &taskEntry{tenant: "批量", group: "api"})
+	}
+	q.push(100, &taskEntry{tenant: "在线"})
+
+	// api 分组在 1 秒后才有名额
+	open := clock.Now().Add(time.Second)
+	checks := 0
+	admit := func(item *queuedTask) (bool, time.Time) {
+		checks++
+		if item.entry.group == "api" && clock.Now().Before(open) {
+			return false, open
+		}
+		return true, time.Time{}
+	}
+
+	item, _ := q.tryPop(admit)
+	if item == nil || item.taskID != 100 {
+		t.Fatalf("应先取出不限流的任务，实际为 %+v", item)
+	}
+	// 第一次遇到限流时每个任务检查一次，之后移出队列，不再逐个检查
+	q.tryPop(admit)
+	before := checks
+	for i := 0; i < 10; i++ {
+		if item, retryAt := q.tryPop(admit); item != nil || !retryAt.Equal(open) {
+			t.Fatalf("限流期间取出 %+v，重试时间 %v，应为 nil 和 %v", item, retryAt, open)
+		}
+	}
+	if checks != before {
+		t.Errorf("限流期间又检查了 %d 次", checks-before)
+	}
+	if q.len() != 100 {
+		t.Errorf("队列长度为 %d，被限流的任务也应计入", q.len())
+	}
+
+	clock.Advance(time.Second)
+	for i := 0; i < 100; i++ {
+		if item, _ := q.tryPop(admit); item == nil || item.taskID != i {
+			t.Fatalf("到时间后第 %d 次取出 %+v，应按入队顺序取出", i+1, item)
+		}
+	}
+}
+
+func TestQueuePopsByPriorityThenFIFO(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	q := newReadyQueue(clock, 0, nil)
+	for i, priority := range []int{0, 5, 0, 10, 5} {
+		q.push(i, &taskEntry{priority: priority})
+	}
+
+	// 优先级高的先出队，相同优先级按入队顺序
+	for _, want := range []int{3, 1, 4, 0, 2} {
+		if item, _ := q.tryPop(nil); item == nil || item.taskID != want {
+			t.Fatalf("取出 %+v，应为任务 %d", item, want)
+		}
+	}
+}
+
+func TestQueueAgingPromotesWaitingTasks(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	q := newReadyQueue(clock, time.Second, nil)
+	q.push(0, &taskEntry{priority: 0})
+
+	// 等待 10 秒后优先级提升到 10，先于之后入队的优先级 5 的任务，但不超过优先级 20 的任务
+	clock.Advance(10 * time.Second)
+	q.push(1, &taskEntry{priority: 5})
+	q.push(2, &taskEntry{priority: 20})
+	for _, want := range []int{2, 0, 1} {
+		if item, _ := q.tryPop(nil); item == nil || item.taskID != want {
+			t.Fatalf("取出 %+v，应为任务 %d", item, want)
+		}
+	}
+}
+
+func TestQueueTenantHeapFollowsWeights(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	q := newReadyQueue(clock, 0, map[string]float64{"在线": 3})
+	for i := 0; i < 8; i++ {
+		q.push(2*i, &taskEntry{tenant: "在线"})
+		q.push(2*i+1, &taskEntry{tenant: "批量"})
+	}
+
+	// 4 个 worker 同时取任务，权重 3:1 时在线租户得到 3 个
+	counts := map[string]int{}
+	for i := 0; i < 4; i++ {
+		item, _ := q.tryPop(nil)
+		counts[item.entry.tenant]++
+	}
+	if counts["在线"] != 3 || counts["批量"] != 1 {
+		t.Errorf("权重 3:1 时分配为 %v", counts)
+	}
+}
+
+func TestThrottledHeadKeepsResourceReservation(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ts := NewTaskScheduler(4)
+	ts.SetClock(clock)
+	ts.SetResourceBudget(Resources{CPU: 4})
+	ts.SetGroupLimit("api", GroupLimit{Rate: 1, Burst: 1})
+	admit := ts.admitFunc(context.Background())
+
+	// 一个 api 任务用掉令牌，一个任务占着 2 个 CPU
+	q := newReadyQueue(clock, 0, nil)
+	q.push(0, &taskEntry{group: "api"})
+	q.push(1, &taskEntry{resources: Resources{CPU: 2}})
+	q.tryPop(admit)
+	running, _ := q.tryPop(admit)
+	if running == nil || running.taskID != 1 {
+		t.Fatalf("占用 CPU 的任务应当直接出队，实际为 %+v", running)
+	}
+
+	// 大任务资源不够，排在等待资源的最前面
+	q.push(2, &taskEntry{group: "api", resources: Resources{CPU: 4}})
+	if item, _ := q.tryPop(admit); item != nil {
+		t.Fatalf("资源不够时取出了任务 %d", item.taskID)
+	}
+
+	// 资源归还后大任务拿得到资源但被限流，之后的小任务不能趁它归还资源时先执行
+	ts.resources.release(running)
+	q.wakeBlocked()
+	q.push(3, &taskEntry{resources: Resources{CPU: 1}})
+	if item, _ := q.tryPop(admit); item != nil {
+		t.Fatalf("大任务被限流时取出了任务 %d", item.taskID)
+	}
+	if used, _ := ts.ResourceUsage(); used.CPU != 0 {
+		t.Errorf("被限流的任务仍占用 %d 个 CPU", used.CPU)
+	}
+
+	clock.Advance(time.Second)
+	big, _ := q.tryPop(admit)
+	if big == nil || big.taskID != 2 {
+		t.Fatalf("限流结束后取出 %+v，应为大任务", big)
+	}
+	if !ts.resources.forget(big) {
+		t.Error("大任务出队前应一直排在等待资源的最前面")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 分组限制：令牌桶限速和并发上限，零值表示不限制
+// 同组任务共享限制，与全局 worker 数量同时生效
+type GroupLimit struct {
+	Rate          float64 // 每秒允许开始的任务数
+	Burst         int     // 令牌桶容量，默认 1
+	MaxConcurrent int     // 同时运行的任务数上限
+}
+
+// 单个分组的运行状态
+type groupState struct {
+	limit   GroupLimit
+	tokens  float64
+	last    time.Time // 上次补充令牌的时间
+	running int
+}
+
+// 分组限流器
+type groupLimiter struct {
+	mu     sync.Mutex
+	groups map[string]*groupState
+}
+
+func newGroupLimiter() *groupLimiter {
+	return &groupLimiter{groups: make(map[string]*groupState)}
+}
+
+// 设置分组限制，可以在运行中调整
+func (ts *TaskScheduler) SetGroupLimit(group string, limit GroupLimit) {
+	ts.groups.set(group, limit)
+
+	ts.mu.Lock()
+	queue := ts.queue
+	ts.mu.Unlock()
+	if queue != nil {
+		queue.wake()
+	}
+}
+
+func (g *groupLimiter) set(group string, limit GroupLimit) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	state, ok := g.groups[group]
+	if !ok {
+		state = &groupState{tokens: float64(limit.Burst)}
+		g.groups[group] = state
+	}
+	state.limit = limit
+	state.tokens = min(state.tokens, float64(limit.Burst))
+}
+
+// 尝试为任务获取分组的令牌和并发名额
+// 被限速时返回下一个令牌可用的时间，并发已满时返回零值，等有任务结束再检查
+func (g *groupLimiter) tryAcquire(item *queuedTask, now time.Time) (bool, time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	state, ok := g.groups[item.entry.group]
+	if !ok {
+		return true, time.Time{}
+	}
+
+	limit := state.limit
+	if limit.MaxConcurrent > 0 && state.running >= limit.MaxConcurrent {
+		return false, time.Time{}
+	}
+
+	if limit.Rate > 0 {
+		if state.last.IsZero() {
+			state.last = now
+		}
+		state.tokens = min(state.tokens+now.Sub(state.last).Seconds()*limit.Rate, float64(limit.Burst))
+		state.last = now
+		if state.tokens < 1 {
+			wait := time.Duration((1 - state.tokens) / limit.Rate * float64(time.Second))
+			return false, now.Add(wait)
+		}
+		state.tokens--
+	}
+
+	state.running++
+	item.holdsGroup = true
+	return true, time.Time{}
+}
+
+// 任务结束后归还并发名额
+func (g *groupLimiter) release(group string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if state, ok := g.groups[group]; ok && state.running > 0 {
+		state.running--
+	}
+}
+
+func demoRateLimit() {
+	fmt.Println("演示13：分组限流")
+
+	scheduler := NewTaskScheduler(4)
+	// 外部接口每秒最多 5 次调用，同时最多 2 个
+	scheduler.SetGroupLimit("api", GroupLimit{Rate: 5, MaxConcurrent: 2})
+
+	for i := 1; i <= 6; i++ {
+		name := fmt.Sprintf("调用接口%d", i)
+		scheduler.AddTaskWithOptions(sleepStep(name, 300*time.Millisecond, nil), TaskOptions{Name: name, Group: "api"})
+	}
+	// 本地任务不受限制
+	for i := 1; i <= 2; i++ {
+		name := fmt.Sprintf("本地计算%d", i)
+		scheduler.AddTaskWithOptions(sleepStep(name, 100*time.Millisecond, nil), TaskOptions{Name: name, Group: "local"})
+	}
+	scheduler.RunParallel()
+
+	for _, result := range scheduler.GetResults() {
+		if result.Group == "api" {
+			fmt.Printf("%s 开始于 %v，限流 %v\n", result.Name, result.StartTime.Sub(result.QueuedAt).Round(10*time.Millisecond), result.ThrottleWait.Round(10*time.Millisecond))
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// 模拟模式下执行，返回每个任务相对起点的开始时间
+func groupStarts(t *testing.T, scheduler *TaskScheduler, sim *Simulation) []time.Duration {
+	t.Helper()
+
+	origin := sim.Now()
+	runSimulated(t, scheduler, 5*time.Second)
+	var starts []time.Duration
+	for _, r := range scheduler.GetResults() {
+		if r.Status != StatusSuccess {
+			t.Fatalf("任务 %d 状态为 %s", r.TaskID+1, r.Status)
+		}
+		starts = append(starts, r.StartTime.Sub(origin))
+	}
+	return starts
+}
+
+func TestGroupRateLimit(t *testing.T) {
+	sim := NewSimulation(1)
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetQuiet(true)
+	scheduler.SetSimulation(sim)
+	scheduler.SetGroupLimit("api", GroupLimit{Rate: 1, Burst: 2})
+	task := func(ctx context.Context) error { return Sleep(ctx, 100*time.Millisecond) }
+	for i := 0; i < 5; i++ {
+		scheduler.AddTaskWithOptions(task, TaskOptions{Group: "api"})
+	}
+	scheduler.AddTaskWithOptions(task, TaskOptions{Group: "local"})
+
+	// 桶中的 2 个令牌立即可用，之后每秒 1 个；其他分组不受影响
+	starts := groupStarts(t, scheduler, sim)
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 3 * time.Second, 0}
+	for i := range want {
+		if starts[i] != want[i] {
+			t.Errorf("任务 %d 开始于 +%v，应为 +%v", i+1, starts[i], want[i])
+		}
+	}
+	if r := scheduler.GetResults()[4]; r.ThrottleWait != 3*time.Second {
+		t.Errorf("最后一个 api 任务限流等待 %v，应为 3s", r.ThrottleWait)
+	}
+}
+
+func TestGroupMaxConcurrent(t *testing.T) {
+	sim := NewSimulation(1)
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetQuiet(true)
+	scheduler.SetSimulation(sim)
+	scheduler.SetGroupLimit("db", GroupLimit{MaxConcurrent: 2})
+	task := func(ctx context.Context) error { return Sleep(ctx, time.Second) }
+	for i := 0; i < 5; i++ {
+		scheduler.AddTaskWithOptions(task, TaskOptions{Group: "db"})
+	}
+	scheduler.AddTaskWithOptions(task, TaskOptions{})
+
+	// 同时最多 2 个 db 任务，前面的结束后名额立即交给后面的任务
+	starts := groupStarts(t, scheduler, sim)
+	want := []time.Duration{0, 0, time.Second, time.Second, 2 * time.Second, 0}
+	for i := range want {
+		if starts[i] != want[i] {
+			t.Errorf("任务 %d 开始于 +%v，应为 +%v", i+1, starts[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownTaskType   = errors.New("未注册的任务类型")
+	ErrDuplicateTaskType = errors.New("任务类型已注册")
+)
+
+// 命名任务的执行函数，参数通过可序列化的 payload 传入
+type NamedTaskFunc func(ctx context.Context, payload json.RawMessage) error
+
+// 命名任务注册表：任务用 类型名 + payload 描述，而不是匿名闭包，
+// 因此可以写入日志、在重启后或其他进程中重新执行
+type TaskRegistry struct {
+	mu    sync.RWMutex
+	funcs map[string]NamedTaskFunc
+}
+
+func NewTaskRegistry() *TaskRegistry {
+	return &TaskRegistry{funcs: make(map[string]NamedTaskFunc)}
+}
+
+// 注册任务类型
+func (r *TaskRegistry) Register(name string, fn NamedTaskFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.funcs[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateTaskType, name)
+	}
+	r.funcs[name] = fn
+	return nil
+}
+
+// 查找任务类型
+func (r *TaskRegistry) Lookup(name string) (NamedTaskFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.funcs[name]
+	return fn, ok
+}
+
+// 已注册的任务类型，按名称排序
+func (r *TaskRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.funcs))
+	for name := range r.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 用类型名和 payload 创建可执行的任务
+func (r *TaskRegistry) NewTask(name string, payload json.RawMessage) (ContextTask, error) {
+	fn, ok := r.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTaskType, name)
+	}
+	return func(ctx context.Context) error {
+		return fn(ctx, payload)
+	}, nil
+}
+
+// 设置调度器使用的任务注册表
+func (ts *TaskScheduler) SetRegistry(registry *TaskRegistry) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.registry = registry
+}
+
+// 按类型名提交任务，payload 会被序列化为 JSON
+// 开启日志后提交记录落盘后任务才开始调度，写入失败时任务不会执行并返回错误
+func (ts *TaskScheduler) SubmitNamed(typeName string, payload any, opts TaskOptions) (int, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return -1, fmt.Errorf("序列化任务参数失败: %w", err)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.registry == nil {
+		return -1, fmt.Errorf("%w: %s", ErrUnknownTaskType, typeName)
+	}
+	task, err := ts.registry.NewTask(typeName, raw)
+	if err != nil {
+		return -1, err
+	}
+
+	entry, err := ts.newEntryLocked(task, opts)
+	if err != nil {
+		return -1, err
+	}
+	entry.typeName = typeName
+	entry.payload = raw
+
+	if err := ts.checkSubmitLocked(entry); err != nil {
+		return -1, err
+	}
+	if taskID, found, err := ts.dedupeLocked(opts.Key); found {
+		return taskID, err
+	}
+	if ts.journal == nil {
+		return ts.submitLocked(entry), nil
+	}
+
+	// 提交记录落盘后才调度任务，在锁外等待；
+	// 等待期间占着一个未结束任务的名额，Drain 不会在任务加入队列之前关闭队列
+	written, err := ts.journalSubmitLocked(entry)
+	if err != nil {
+		return -1, err
+	}
+	ts.inflight.Add(1)
+	defer ts.inflight.Done()
+	ts.mu.Unlock()
+	err = <-written
+	ts.mu.Lock()
+
+	if err != nil {
+		return -1, fmt.Errorf("写入任务日志失败: %w", err)
+	}
+	// 等待期间可能有相同幂等键的任务先提交，或者依赖的任务已被清理，
+	// 这时任务不再执行，日志中记为取消，重启后也不会执行
+	if taskID, found, err := ts.dedupeLocked(opts.Key); found {
+		ts.journalAbandonLocked(entry, ErrDuplicateTask)
+		return taskID, err
+	}
+	for _, dep := range entry.deps {
+		if ts.entryLocked(dep) == nil {
+			ts.journalAbandonLocked(entry, ErrTaskEvicted)
+			return -1, fmt.Errorf("%w: %d", ErrTaskEvicted, dep)
+		}
+	}
+	return ts.submitLocked(entry), nil
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 任务事件
+type TaskEvent struct {
+	TaskID int
+	Name   string
+	Group  string
+	Time   time.Time
+}
+
+// 重试事件
+type RetryEvent struct {
+	TaskEvent
+	Attempt int           // 失败的是第几次尝试
+	Backoff time.Duration // 下次尝试前的等待时间
+	Error   error
+}
+
+// 调度器事件观察者
+// 回调在调度器之外的协程中按事件发生的顺序逐个调用，回调中可以调用调度器的方法
+// 批量执行、Drain 和 ReportSummary 返回前，之前的事件都已经通知完
+// 批量执行结束时会调用 OnSummary，服务模式下通过 ReportSummary 触发
+type Observer interface {
+	OnQueued(event TaskEvent)
+	OnStart(event TaskEvent)
+	OnRetry(event RetryEvent)
+	OnFinish(result TaskResult)
+	OnSummary(summary Summary)
+}
+
+// 空实现，嵌入后只需要实现关心的回调
+type BaseObserver struct{}
+
+func (BaseObserver) OnQueued(TaskEvent)  {}
+func (BaseObserver) OnStart(TaskEvent)   {}
+func (BaseObserver) OnRetry(RetryEvent)  {}
+func (BaseObserver) OnFinish(TaskResult) {}
+func (BaseObserver) OnSummary(Summary)   {}
+
+// 添加观察者
+func (ts *TaskScheduler) AddObserver(observer Observer) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.observers = append(ts.observers, observer)
+}
+
+// 关闭默认的控制台输出，已添加的观察者不受影响
+func (ts *TaskScheduler) SetQuiet(quiet bool) {
+	ts.quiet.Store(quiet)
+}
+
+// 当前需要通知的观察者，包括默认的控制台输出
+func (ts *TaskScheduler) observersLocked() []Observer {
+	if ts.quiet.Load() {
+		return append([]Observer(nil), ts.observers...)
+	}
+	return append([]Observer{consoleReporter}, ts.observers...)
+}
+
+// 把事件交给分发协程，回调在释放调度器锁之后执行，慢的观察者不会卡住 worker
+// fn 中用到的任务信息需要在调用前取好，分发时不再持有锁
+func (ts *TaskScheduler) notifyLocked(fn func(Observer)) {
+	observers := ts.observersLocked()
+	ts.events.post(func() {
+		for _, observer := range observers {
+			fn(observer)
+		}
+	})
+}
+
+// 在不持有锁的地方通知观察者
+func (ts *TaskScheduler) notify(fn func(Observer)) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.notifyLocked(fn)
+}
+
+// 事件分发：按提交顺序在单独的协程中调用，队列不限长度，提交事件不会阻塞
+// 没有事件时协程退出，有新事件时再启动
+type eventDispatcher struct {
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending []func()
+	running bool
+}
+
+func newEventDispatcher() *eventDispatcher {
+	d := &eventDispatcher{}
+	d.idle = sync.NewCond(&d.mu)
+	return d
+}
+
+func (d *eventDispatcher) post(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending = append(d.pending, fn)
+	if !d.running {
+		d.running = true
+		go d.run()
+	}
+}
+
+func (d *eventDispatcher) run() {
+	d.mu.Lock()
+	for len(d.pending) > 0 {
+		batch := d.pending
+		d.pending = nil
+		d.mu.Unlock()
+		for _, fn := range batch {
+			fn()
+		}
+		d.mu.Lock()
+	}
+	d.running = false
+	d.idle.Broadcast()
+	d.mu.Unlock()
+}
+
+// 等待已提交的事件全部通知完，不能在观察者的回调中调用
+func (d *eventDispatcher) flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for d.running {
+		d.idle.Wait()
+	}
+}
+
+// 默认控制台输出之外的调度器日志，SetQuiet 后不再打印
+func (ts *TaskScheduler) logf(format string, args ...any) {
+	if !ts.quiet.Load() {
+		fmt.Printf(format, args...)
+	}
+}
+
+// 统计执行摘要并通知观察者
+func (ts *TaskScheduler) ReportSummary() Summary {
+	summary := ts.Summary()
+	ts.notify(func(o Observer) { o.OnSummary(summary) })
+	ts.events.flush()
+	return summary
+}
+
+// 默认的控制台输出
+var consoleReporter = NewTextReporter(os.Stdout)
+
+// 文本输出
+type TextReporter struct {
+	BaseObserver
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewTextReporter(w io.Writer) *TextReporter {
+	return &TextReporter{w: w}
+}
+
+func (r *TextReporter) OnRetry(event RetryEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintf(r.w, "   任务 %d 第 %d 次尝试失败，%v 后重试: %v\n", event.TaskID+1, event.Attempt, event.Backoff, event.Error)
+}
+
+func (r *TextReporter) OnFinish(result TaskResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := "✓ 成功"
+	if !result.Success {
+		status = "✗ " + result.Status.String()
+	}
+
+	fmt.Fprintf(r.w, "任务 %d", result.TaskID+1)
+	if result.Name != "" {
+		fmt.Fprintf(r.w, "(%s)", result.Name)
+	}
+	fmt.Fprintf(r.w, " [%s] - 耗时: %v", status, result.Duration)
+
+	if result.QueueWait > 0 {
+		fmt.Fprintf(r.w, " - 排队: %v", result.QueueWait)
+	}
+
+	if result.ThrottleWait > 0 {
+		fmt.Fprintf(r.w, " - 限流: %v", result.ThrottleWait)
+	}
+
+	if result.AdmissionWait > 0 {
+		fmt.Fprintf(r.w, " - 资源等待: %v", result.AdmissionWait)
+	}
+
+	if len(result.Attempts) > 1 {
+		fmt.Fprintf(r.w, " - 尝试: %d 次", len(result.Attempts))
+	}
+
+	if result.Error != nil {
+		fmt.Fprintf(r.w, " - 错误: %v", result.Error)
+	}
+	fmt.Fprintln(r.w)
+}
+
+func (r *TextReporter) OnSummary(summary Summary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summary.WriteText(r.w)
+}
+
+// JSON Lines 输出，每个事件一行，时长单位为毫秒
+type JSONLinesReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONLinesReporter(w io.Writer) *JSONLinesReporter {
+	return &JSONLinesReporter{enc: json.NewEncoder(w)}
+}
+
+type jsonEvent struct {
+	Event       string    `json:"event"`
+	TaskID      int       `json:"task_id,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Group       string    `json:"group,omitempty"`
+	Time        time.Time `json:"time"`
+	Attempt     int       `json:"attempt,omitempty"`
+	BackoffMs   float64   `json:"backoff_ms,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Success     *bool     `json:"success,omitempty"`
+	DurationMs  float64   `json:"duration_ms,omitempty"`
+	QueueWaitMs float64   `json:"queue_wait_ms,omitempty"`
+	ThrottleMs  float64   `json:"throttle_ms,omitempty"`
+	AdmissionMs float64   `json:"admission_ms,omitempty"`
+	Attempts    int       `json:"attempts,omitempty"`
+	Error       string    `json:"error,omitempty"`
+
+	Total      *int    `json:"total,omitempty"`
+	Succeeded  *int    `json:"succeeded,omitempty"`
+	Failed     *int    `json:"failed,omitempty"`
+	Panicked   *int    `json:"panicked,omitempty"`
+	MakespanMs float64 `json:"makespan_ms,omitempty"`
+	AvgMs      float64 `json:"avg_duration_ms,omitempty"`
+	P99Ms      float64 `json:"p99_ms,omitempty"`
+	SuccessPct float64 `json:"success_rate,omitempty"`
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func (r *JSONLinesReporter) write(event jsonEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.enc.Encode(event)
+}
+
+func (r *JSONLinesReporter) OnQueued(event TaskEvent) {
+	r.write(jsonEvent{Event: "queued", TaskID: event.TaskID + 1, Name: event.Name, Group: event.Group, Time: event.Time})
+}
+
+func (r *JSONLinesReporter) OnStart(event TaskEvent) {
+	r.write(jsonEvent{Event: "start", TaskID: event.TaskID + 1, Name: event.Name, Group: event.Group, Time: event.Time})
+}
+
+func (r *JSONLinesReporter) OnRetry(event RetryEvent) {
+	r.write(jsonEvent{
+		Event:     "retry",
+		TaskID:    event.TaskID + 1,
+		Name:      event.Name,
+		Group:     event.Group,
+		Time:      event.Time,
+		Attempt:   event.Attempt,
+		BackoffMs: millis(event.Backoff),
+		Error:     errorString(event.Error),
+	})
+}
+
+func (r *JSONLinesReporter) OnFinish(result TaskResult) {
+	r.write(jsonEvent{
+		Event:       "finish",
+		TaskID:      result.TaskID + 1,
+		Name:        result.Name,
+		Group:       result.Group,
+		Time:        result.EndTime,
+		Status:      result.Status.String(),
+		Success:     &result.Success,
+		DurationMs:  millis(result.Duration),
+		QueueWaitMs: millis(result.QueueWait),
+		ThrottleMs:  millis(result.ThrottleWait),
+		AdmissionMs: millis(result.AdmissionWait),
+		Attempts:    len(result.Attempts),
+		Error:       errorString(result.Error),
+	})
+}
+
+func (r *JSONLinesReporter) OnSummary(summary Summary) {
+	r.write(jsonEvent{
+		Event:      "summary",
+		Time:       time.Now(),
+		Total:      &summary.Total,
+		Succeeded:  &summary.Succeeded,
+		Failed:     &summary.Failed,
+		Panicked:   &summary.Panicked,
+		DurationMs: millis(summary.TotalDuration),
+		MakespanMs: millis(summary.Makespan),
+		AvgMs:      millis(summary.AvgDuration),
+		P99Ms:      millis(summary.P99),
+		SuccessPct: summary.SuccessRate,
+	})
+}
+
+// JUnit XML 输出，收到摘要时把全部任务写成一个 testsuite
+// 失败和超时记为 failure，崩溃记为 error，跳过和取消记为 skipped
+type JUnitReporter struct {
+	BaseObserver
+	mu    sync.Mutex
+	w     io.Writer
+	suite string
+}
+
+func NewJUnitReporter(w io.Writer, suite string) *JUnitReporter {
+	return &JUnitReporter{w: w, suite: suite}
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func (r *JUnitReporter) OnSummary(summary Summary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	suite := junitSuite{
+		Name:  r.suite,
+		Tests: len(summary.Results),
+		Time:  seconds(summary.Makespan),
+	}
+	for _, result := range summary.Results {
+		name := result.Name
+		if name == "" {
+			name = fmt.Sprintf("任务 %d", result.TaskID+1)
+		}
+		tc := junitCase{Name: name, ClassName: r.suite, Time: seconds(result.Duration)}
+		if result.Group != "" {
+			tc.ClassName = r.suite + "." + result.Group
+		}
+
+		msg := &junitMessage{Message: errorString(result.Error), Type: result.Status.String()}
+		switch result.Status {
+		case StatusSuccess:
+		case StatusPanicked:
+			suite.Errors++
+			tc.Error = msg
+			if result.Panic != nil {
+				msg.Body = string(result.Panic.Stack)
+			}
+		case StatusSkipped, StatusCancelled:
+			suite.Skipped++
+			tc.Skipped = msg
+		default:
+			suite.Failures++
+			tc.Failure = msg
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	io.WriteString(r.w, xml.Header)
+	enc := xml.NewEncoder(r.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		fmt.Fprintf(os.Stderr, "写入 JUnit 报告失败: %v\n", err)
+	}
+	fmt.Fprintln(r.w)
+}
+
+func demoReporters() {
+	fmt.Println("演示15：事件观察者与报告输出")
+
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: 20 * time.Millisecond})
+	scheduler.AddObserver(NewJSONLinesReporter(os.Stdout))
+	scheduler.AddTaskWithOptions(sleepStep("编译", 50*time.Millisecond, nil), TaskOptions{Name: "编译"})
+	scheduler.AddTaskWithOptions(sleepStep("单元测试", 30*time.Millisecond, errBadRequest), TaskOptions{Name: "单元测试", DependsOn: []int{0}})
+	scheduler.AddTaskWithOptions(sleepStep("打包", 30*time.Millisecond, nil), TaskOptions{Name: "打包", DependsOn: []int{1}})
+	scheduler.RunParallel()
+
+	fmt.Println("同样的结果输出为 JUnit XML:")
+	NewJUnitReporter(os.Stdout, "构建流水线").OnSummary(scheduler.Summary())
+	fmt.Println()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJUnitSuiteTimeIsMakespan(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewJUnitReporter(&buf, "并行")
+	reporter.OnSummary(Summary{
+		Results: []TaskResult{
+			{Name: "甲", Success: true, Status: StatusSuccess, Duration: 2 * time.Second},
+			{Name: "乙", Success: true, Status: StatusSuccess, Duration: 2 * time.Second},
+		},
+		TotalDuration: 4 * time.Second,
+		Makespan:      2 * time.Second,
+	})
+
+	// 两个任务并行执行，整个测试套件用时是墙钟时间而不是任务耗时之和
+	_, suite, _ := strings.Cut(buf.String(), "<testsuite ")
+	suite, _, _ = strings.Cut(suite, ">")
+	if !strings.Contains(suite, `time="2.000"`) {
+		t.Errorf("testsuite 的 time 应为 2.000: <testsuite %s>", suite)
+	}
+}
+
+// 第一次收到事件后一直阻塞到 release 关闭，记录收到的事件
+type blockingObserver struct {
+	BaseObserver
+	ts      *TaskScheduler
+	release chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	events  []string
+}
+
+func (o *blockingObserver) record(kind string, taskID int) {
+	o.once.Do(func() { <-o.release })
+	// 回调不在调度器锁内，可以调用调度器的方法
+	o.ts.Tasks()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, fmt.Sprintf("%s %d", kind, taskID))
+}
+
+func (o *blockingObserver) OnQueued(event TaskEvent)   { o.record("queued", event.TaskID) }
+func (o *blockingObserver) OnStart(event TaskEvent)    { o.record("start", event.TaskID) }
+func (o *blockingObserver) OnFinish(result TaskResult) { o.record("finish", result.TaskID) }
+
+func TestSlowObserverDoesNotBlockScheduler(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	observer := &blockingObserver{ts: scheduler, release: make(chan struct{})}
+	scheduler.AddObserver(observer)
+	scheduler.Start()
+
+	// 观察者卡住时任务照常提交、执行和等待
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			taskID, err := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			scheduler.Wait(taskID)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("观察者阻塞时调度器也被卡住")
+	}
+
+	// Drain 返回前事件按发生顺序全部通知完
+	close(observer.release)
+	scheduler.Drain()
+	want := []string{
+		"queued 0", "start 0", "finish 0",
+		"queued 1", "start 1", "finish 1",
+		"queued 2", "start 2", "finish 2",
+	}
+	if got := strings.Join(observer.events, ", "); got != strings.Join(want, ", ") {
+		t.Errorf("收到的事件为 %s，应为 %s", got, strings.Join(want, ", "))
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 任务声明的资源占用，也用作调度器的资源预算
+type Resources struct {
+	CPU      int `json:"cpu"`       // CPU 单位，例如 1 表示一个核
+	MemoryMB int `json:"memory_mb"` // 内存，单位 MB
+}
+
+func (r Resources) isZero() bool {
+	return r.CPU <= 0 && r.MemoryMB <= 0
+}
+
+// 加权信号量：只有全部任务声明的资源之和不超过预算时才放行
+// 放不下的任务会排在最前面，之后声明了资源的任务需要等它先获得资源，避免大任务一直等待
+type resourcePool struct {
+	mu     sync.Mutex
+	budget Resources // 0 表示该项不限制
+	used   Resources
+	head   *queuedTask // 正在等待资源的任务
+}
+
+// 设置资源预算，0 表示该项不限制
+func (ts *TaskScheduler) SetResourceBudget(budget Resources) {
+	ts.resources.mu.Lock()
+	ts.resources.budget = budget
+	ts.resources.mu.Unlock()
+
+	ts.mu.Lock()
+	queue := ts.queue
+	ts.mu.Unlock()
+	if queue != nil {
+		queue.wake()
+	}
+}
+
+// 当前已占用的资源和预算
+func (ts *TaskScheduler) ResourceUsage() (used, budget Resources) {
+	ts.resources.mu.Lock()
+	defer ts.resources.mu.Unlock()
+
+	return ts.resources.used, ts.resources.budget
+}
+
+// 任务实际需要的资源，超过预算的部分按预算计算，否则永远无法执行
+func (p *resourcePool) needLocked(r Resources) Resources {
+	if p.budget.CPU <= 0 {
+		r.CPU = 0
+	}
+	if p.budget.MemoryMB <= 0 {
+		r.MemoryMB = 0
+	}
+	return Resources{
+		CPU:      min(max(r.CPU, 0), p.budget.CPU),
+		MemoryMB: min(max(r.MemoryMB, 0), p.budget.MemoryMB),
+	}
+}
+
+// 尝试为任务获取资源
+func (p *resourcePool) tryAcquire(item *queuedTask) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	need := p.needLocked(item.entry.resources)
+	if need.isZero() {
+		return true
+	}
+	if p.head != nil && p.head != item {
+		return false
+	}
+
+	if p.used.CPU+need.CPU > p.budget.CPU && need.CPU > 0 ||
+		p.used.MemoryMB+need.MemoryMB > p.budget.MemoryMB && need.MemoryMB > 0 {
+		p.head = item
+		return false
+	}
+
+	// 拿到资源后仍然占着最前面的位置，直到通过分组限流真正出队，
+	// 否则被限流时归还资源，后面的小任务又会抢在它前面
+	p.used.CPU += need.CPU
+	p.used.MemoryMB += need.MemoryMB
+	item.resources = need
+	item.holdsResources = true
+	return true
+}
+
+// 归还任务占用的资源
+func (p *resourcePool) release(item *queuedTask) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !item.holdsResources {
+		return
+	}
+	p.used.CPU -= item.resources.CPU
+	p.used.MemoryMB -= item.resources.MemoryMB
+	item.holdsResources = false
+}
+
+// 任务不再等待资源：已经出队执行，或者调度器取消后直接出队
+// 返回任务之前是否排在最前面，是的话被它挡住的任务可以重新检查
+func (p *resourcePool) forget(item *queuedTask) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.head != item {
+		return false
+	}
+	p.head = nil
+	return true
+}
+
+func demoResources() {
+	fmt.Println("演示22：按资源占用调度")
+
+	// 4 个 worker，但只有 4 个 CPU 单位和 1GB 内存
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetResourceBudget(Resources{CPU: 4, MemoryMB: 1024})
+
+	heavy := Resources{CPU: 4, MemoryMB: 512}
+	light := Resources{CPU: 1, MemoryMB: 256}
+	scheduler.AddTaskWithOptions(sleepStep("模型训练", 200*time.Millisecond, nil), TaskOptions{Name: "模型训练", Resources: heavy})
+	for i := 1; i <= 4; i++ {
+		name := fmt.Sprintf("数据清洗%d", i)
+		scheduler.AddTaskWithOptions(sleepStep(name, 100*time.Millisecond, nil), TaskOptions{Name: name, Resources: light})
+	}
+	scheduler.AddTaskWithOptions(sleepStep("生成索引", 150*time.Millisecond, nil), TaskOptions{Name: "生成索引", Resources: Resources{CPU: 2, MemoryMB: 768}})
+	scheduler.AddTaskWithOptions(sleepStep("发送通知", 50*time.Millisecond, nil), TaskOptions{Name: "发送通知"})
+	scheduler.RunParallel()
+}
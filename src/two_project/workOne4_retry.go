@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// 重试策略
+type RetryPolicy struct {
+	MaxAttempts    int                  // 最大尝试次数（含第一次），小于等于1表示不重试
+	InitialBackoff time.Duration        // 第一次重试前的等待时间
+	MaxBackoff     time.Duration        // 等待时间上限，0 表示不限制
+	Multiplier     float64              // 每次重试等待时间的倍数，默认为 2
+	Jitter         float64              // 随机抖动比例，取值 0~1，超出范围的按边界处理
+	Retryable      func(err error) bool // 判断错误是否可以重试，nil 表示都可以重试
+}
+
+// 单次尝试的结果
+type AttemptResult struct {
+	Attempt   int
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  time.Duration
+	Error     error
+	Status    TaskStatus
+}
+
+// 设置默认重试策略，对没有单独指定策略的任务生效
+func (ts *TaskScheduler) SetRetryPolicy(policy RetryPolicy) {
+	ts.retry = policy
+}
+
+// 获取任务实际使用的重试策略
+func (ts *TaskScheduler) retryPolicy(entry *taskEntry) RetryPolicy {
+	if entry.retry != nil {
+		return *entry.retry
+	}
+	return ts.retry
+}
+
+// 判断本次尝试后是否需要重试
+func (p RetryPolicy) shouldRetry(attempt int, a AttemptResult) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+
+	// 成功或被取消的任务不再重试
+	if a.Status != StatusFailed && a.Status != StatusTimeout {
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(a.Error)
+	}
+	return true
+}
+
+// 计算第 attempt 次失败后的等待时间（指数退避 + 抖动）
+func (p RetryPolicy) backoff(attempt int, rnd *rand.Rand) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	// 没有设置上限时也不能超出 time.Duration 的范围，超出后转换的结果是不确定的
+	limit := float64(math.MaxInt64)
+	if p.MaxBackoff > 0 {
+		limit = float64(p.MaxBackoff)
+	}
+
+	d := float64(p.InitialBackoff)
+	if d <= 0 {
+		return 0
+	}
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= multiplier
+	}
+	d = min(d, limit)
+
+	// 在 [d*(1-jitter), d*(1+jitter)] 范围内随机
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		d *= 1 + jitter*(2*rnd.Float64()-1)
+	}
+	if d >= float64(math.MaxInt64) {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+// 等待一段时间，上下文取消时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	return Sleep(ctx, d) == nil
+}
+
+// 不可重试的错误
+var errBadRequest = errors.New("参数错误")
+
+func demoRetry() {
+	fmt.Println("演示6：失败重试")
+
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetRetryPolicy(RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     200 * time.Millisecond,
+		Jitter:         0.2,
+		Retryable: func(err error) bool {
+			return !errors.Is(err, errBadRequest)
+		},
+	})
+
+	// 前两次失败，第三次成功
+	var calls int32
+	scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+		n := atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		if n < 3 {
+			return fmt.Errorf("第 %d 次调用失败", n)
+		}
+		fmt.Println("   不稳定任务最终完成")
+		return nil
+	}, TaskOptions{Name: "不稳定任务"})
+
+	// 不可重试的错误只执行一次
+	scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+		return errBadRequest
+	}, TaskOptions{Name: "参数错误任务"})
+
+	// 单独指定策略：不重试
+	scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+		return errors.New("总是失败")
+	}, TaskOptions{Name: "不重试任务", Retry: &RetryPolicy{MaxAttempts: 1}})
+
+	scheduler.RunParallel()
+
+	for _, result := range scheduler.GetResults() {
+		for _, a := range result.Attempts {
+			fmt.Printf("   %s 第 %d 次尝试 [%s] 耗时 %v", result.Name, a.Attempt, a.Status, a.Duration)
+			if a.Error != nil {
+				fmt.Printf(" 错误: %v", a.Error)
+			}
+			fmt.Println()
+		}
+	}
+	fmt.Println()
+}
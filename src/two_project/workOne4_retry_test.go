@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoffGrowsUpToMax(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	rnd := rand.New(rand.NewSource(1))
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := p.backoff(i+1, rnd); got != w*time.Millisecond {
+			t.Errorf("第 %d 次重试等待 %v，应为 %v", i+1, got, w*time.Millisecond)
+		}
+	}
+}
+
+func TestRetryBackoffJitterBounds(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	base := 100 * time.Millisecond
+	for _, jitter := range []float64{0.5, 1, 3, -1} {
+		p := RetryPolicy{InitialBackoff: base, Jitter: jitter}
+		// 超出范围的抖动按 0~1 处理，等待时间不会是负数，也不会超过两倍
+		lo, hi := base/2, base*3/2
+		switch {
+		case jitter >= 1:
+			lo, hi = 0, 2*base
+		case jitter <= 0:
+			lo, hi = base, base
+		}
+		for range 1000 {
+			if d := p.backoff(1, rnd); d < lo || d > hi {
+				t.Fatalf("抖动 %v 的等待时间 %v 超出 [%v, %v]", jitter, d, lo, hi)
+			}
+		}
+	}
+}
+
+func TestRetryBackoffDoesNotOverflow(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	policies := []RetryPolicy{
+		{InitialBackoff: time.Second},
+		{InitialBackoff: time.Second, Multiplier: 10, Jitter: 0.5},
+		{InitialBackoff: time.Second, Multiplier: math.Inf(1)},
+	}
+	for _, p := range policies {
+		prev := time.Duration(0)
+		for attempt := 1; attempt <= 200; attempt++ {
+			d := p.backoff(attempt, rnd)
+			if d < 0 {
+				t.Fatalf("倍数 %v 第 %d 次重试的等待时间溢出为 %v", p.Multiplier, attempt, d)
+			}
+			if p.Jitter == 0 && d < prev {
+				t.Fatalf("倍数 %v 第 %d 次重试的等待时间 %v 比上一次 %v 短", p.Multiplier, attempt, d, prev)
+			}
+			prev = d
+		}
+	}
+}
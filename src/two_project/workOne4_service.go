@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSchedulerRunning = errors.New("调度器已在运行")
+	ErrSchedulerStopped = errors.New("调度器未运行或正在停止")
+	ErrTaskNotSubmitted = errors.New("任务尚未提交")
+	ErrTaskEvicted      = errors.New("任务已结束并被清理")
+)
+
+// 服务模式下已结束任务的默认保留时间
+const defaultHistory = 10 * time.Minute
+
+// 已结束的任务和结束时间
+type finishedTask struct {
+	taskID int
+	at     time.Time
+}
+
+// 设置服务模式下已结束任务的保留时间，默认 10 分钟，0 表示一直保留
+// 超过保留时间的任务在之后提交新任务时被清理，Wait、TaskInfo 等返回 ErrTaskEvicted，
+// 摘要和管理接口中也不再包含它们；幂等键随任务一起释放
+func (ts *TaskScheduler) SetHistory(retention time.Duration) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.history = max(retention, 0)
+}
+
+// 下一个任务的ID
+func (ts *TaskScheduler) nextIDLocked() int {
+	return ts.base + len(ts.tasks)
+}
+
+// 按ID查找任务，已被清理或不存在时返回 nil，供内部已知ID有效的路径使用
+func (ts *TaskScheduler) entryLocked(taskID int) *taskEntry {
+	if taskID < ts.base || taskID >= ts.nextIDLocked() {
+		return nil
+	}
+	return ts.tasks[taskID-ts.base]
+}
+
+// 按调用方传入的ID查找任务
+func (ts *TaskScheduler) lookupLocked(taskID int) (*taskEntry, error) {
+	if taskID < 0 || taskID >= ts.nextIDLocked() {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownTask, taskID)
+	}
+	entry := ts.entryLocked(taskID)
+	if entry == nil {
+		return nil, fmt.Errorf("%w: %d", ErrTaskEvicted, taskID)
+	}
+	return entry, nil
+}
+
+// 清理结束超过保留时间的任务，再去掉 tasks 开头已清理的部分
+func (ts *TaskScheduler) evictLocked() {
+	if ts.history <= 0 {
+		return
+	}
+
+	cutoff := ts.clock.Now().Add(-ts.history)
+	n := 0
+	for ; n < len(ts.finished) && !ts.finished[n].at.After(cutoff); n++ {
+		taskID := ts.finished[n].taskID
+		if entry := ts.entryLocked(taskID); entry != nil {
+			ts.forgetKeyLocked(entry.key, taskID)
+			ts.tasks[taskID-ts.base] = nil
+		}
+	}
+	ts.finished = ts.finished[n:]
+
+	trim := 0
+	for trim < len(ts.tasks) && ts.tasks[trim] == nil {
+		trim++
+	}
+	ts.tasks = ts.tasks[trim:]
+	ts.base += trim
+}
+
+// 以常驻服务模式启动工作协程，之后可以并发调用 Submit 提交任务
+func (ts *TaskScheduler) Start() error {
+	return ts.StartContext(context.Background())
+}
+
+// 以常驻服务模式启动，parent 被取消时所有任务都会收到取消信号
+// 设置了日志时，启动后会重新提交日志中没有完成的任务
+func (ts *TaskScheduler) StartContext(parent context.Context) error {
+	if ts.sim != nil {
+		return ErrSimulationBatchOnly
+	}
+	if err := ts.startWorkers(parent, max(ts.maxWorkers, 1), true); err != nil {
+		return err
+	}
+	if ts.journal != nil {
+		return ts.replayJournal()
+	}
+	return nil
+}
+
+// 提交任务并立即返回任务ID，可以在多个协程中并发调用
+// 依赖只能引用已经提交过的任务
+func (ts *TaskScheduler) Submit(task ContextTask, opts TaskOptions) (int, error) {
+	return ts.submitWith(task, opts, nil)
+}
+
+// 提交任务，onSubmit 在持有锁时调用，coalesced 表示合并到了已有任务
+func (ts *TaskScheduler) submitWith(task ContextTask, opts TaskOptions, onSubmit func(taskID int, coalesced bool)) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	entry, err := ts.newEntryLocked(task, opts)
+	if err != nil {
+		return -1, err
+	}
+	if err := ts.checkSubmitLocked(entry); err != nil {
+		return -1, err
+	}
+	if taskID, found, err := ts.dedupeLocked(opts.Key); found {
+		if err == nil && onSubmit != nil {
+			onSubmit(taskID, true)
+		}
+		return taskID, err
+	}
+
+	taskID := ts.submitLocked(entry)
+	if onSubmit != nil {
+		onSubmit(taskID, false)
+	}
+	return taskID, nil
+}
+
+// 检查任务能否提交：调度器需要在运行，依赖的任务需要已经提交
+func (ts *TaskScheduler) checkSubmitLocked(entry *taskEntry) error {
+	if !ts.accepting {
+		return ErrSchedulerStopped
+	}
+	for _, dep := range entry.deps {
+		if ts.entryLocked(dep).state == stateIdle {
+			return fmt.Errorf("%w: %d", ErrTaskNotSubmitted, dep)
+		}
+	}
+	return nil
+}
+
+// 保存任务并开始调度，返回任务ID
+func (ts *TaskScheduler) submitLocked(entry *taskEntry) int {
+	ts.evictLocked()
+	taskID := ts.nextIDLocked()
+	ts.tasks = append(ts.tasks, entry)
+	ts.registerKeyLocked(entry, taskID)
+	ts.activateLocked(taskID)
+	return taskID
+}
+
+// 停止接收新任务，等待已提交的任务全部执行完后停止工作协程
+// 周期任务会先被停止，返回前观察者已收到全部事件
+func (ts *TaskScheduler) Drain() {
+	defer ts.events.flush()
+	ts.stopRecurring()
+
+	ts.mu.Lock()
+	if !ts.running {
+		ts.mu.Unlock()
+		return
+	}
+	ts.accepting = false
+	queue := ts.queue
+	ts.mu.Unlock()
+
+	ts.inflight.Wait()
+	queue.close()
+	ts.workers.Wait()
+
+	ts.mu.Lock()
+	pool := ts.pool
+	ts.pool = nil
+	ts.mu.Unlock()
+	if pool != nil {
+		pool.stop()
+	}
+
+	ts.mu.Lock()
+	ts.running = false
+	ts.poolSize = 0
+	ts.stoppedAt = ts.clock.Now()
+	if ts.cancel != nil {
+		ts.cancel()
+		ts.cancel = nil
+	}
+	ts.mu.Unlock()
+}
+
+// 停止接收新任务并取消所有任务：运行中的任务收到取消信号，排队中的任务不再执行
+func (ts *TaskScheduler) Stop() {
+	ts.Cancel()
+	ts.Drain()
+}
+
+// 等待任务结束并返回结果
+func (ts *TaskScheduler) Wait(taskID int) (TaskResult, error) {
+	ts.mu.Lock()
+	entry, err := ts.lookupLocked(taskID)
+	if err != nil {
+		ts.mu.Unlock()
+		return TaskResult{}, err
+	}
+	done := entry.done
+	ts.mu.Unlock()
+
+	if done == nil {
+		return TaskResult{}, fmt.Errorf("%w: %d", ErrTaskNotSubmitted, taskID)
+	}
+	<-done
+
+	// 结束后即使被清理，entry 中仍保留结果
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return entry.result, nil
+}
+
+// 获取已结束任务的结果，任务未结束时返回 false
+func (ts *TaskScheduler) Result(taskID int) (TaskResult, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	entry, err := ts.lookupLocked(taskID)
+	if err != nil || entry.state != stateDone {
+		return TaskResult{}, false
+	}
+	return entry.result, true
+}
+
+func demoServiceMode() {
+	fmt.Println("演示8：常驻服务模式")
+
+	scheduler := NewTaskScheduler(3)
+	if err := scheduler.Start(); err != nil {
+		fmt.Printf("启动失败: %v\n", err)
+		return
+	}
+
+	// 多个客户端并发提交任务
+	var wg sync.WaitGroup
+	for c := 0; c < 3; c++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			for i := 0; i < 3; i++ {
+				name := fmt.Sprintf("客户端%d-请求%d", client+1, i+1)
+				if _, err := scheduler.Submit(sleepStep(name, 100*time.Millisecond, nil), TaskOptions{Name: name}); err != nil {
+					fmt.Printf("提交失败: %v\n", err)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	// 等待单个任务的结果
+	taskID, _ := scheduler.Submit(sleepStep("报表任务", 200*time.Millisecond, nil), TaskOptions{Name: "报表任务", Priority: 10})
+	result, _ := scheduler.Wait(taskID)
+	fmt.Printf("报表任务结果: %s，排队 %v\n", result.Status, result.QueueWait)
+
+	// 排空后不再接收新任务
+	scheduler.Drain()
+	if _, err := scheduler.Submit(sleepStep("迟到的任务", 0, nil), TaskOptions{}); err != nil {
+		fmt.Printf("排空后提交: %v\n", err)
+	}
+
+	fmt.Println("立即停止：取消运行中和排队中的任务")
+	scheduler = NewTaskScheduler(2)
+	scheduler.Start()
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("长任务%d", i+1)
+		scheduler.Submit(sleepStep(name, time.Second, nil), TaskOptions{Name: name})
+	}
+	time.Sleep(200 * time.Millisecond)
+	scheduler.Stop()
+	fmt.Println()
+}
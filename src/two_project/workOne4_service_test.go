@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestServiceModeEvictsFinishedTasks(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetQuiet(true)
+	scheduler.SetClock(clock)
+	scheduler.SetHistory(time.Minute)
+	scheduler.SetDedupe(DedupeReject, time.Hour)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Drain()
+
+	noop := func(ctx context.Context) error { return nil }
+	var old []int
+	for i := 0; i < 100; i++ {
+		taskID, err := scheduler.Submit(noop, TaskOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		old = append(old, taskID)
+	}
+	keyed, _ := scheduler.Submit(noop, TaskOptions{Key: "日报"})
+	for _, taskID := range append(old, keyed) {
+		scheduler.Wait(taskID)
+	}
+
+	// 保留时间内结果仍然可以查询
+	if _, err := scheduler.TaskInfo(old[0]); err != nil {
+		t.Fatalf("保留时间内查询任务出错: %v", err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	latest, err := scheduler.Submit(noop, TaskOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Wait(latest)
+
+	if _, err := scheduler.Wait(old[0]); !errors.Is(err, ErrTaskEvicted) {
+		t.Errorf("已清理任务的 Wait 返回 %v，应为 ErrTaskEvicted", err)
+	}
+	if _, err := scheduler.TaskInfo(old[50]); !errors.Is(err, ErrTaskEvicted) {
+		t.Errorf("已清理任务的 TaskInfo 返回 %v，应为 ErrTaskEvicted", err)
+	}
+	if _, err := scheduler.TaskInfo(latest + 1); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("不存在的任务返回 %v，应为 ErrUnknownTask", err)
+	}
+	if got := len(scheduler.Tasks()); got != 1 {
+		t.Errorf("清理后还有 %d 个任务，应只剩最新的 1 个", got)
+	}
+	if got := scheduler.Summary().Total; got != 1 {
+		t.Errorf("清理后摘要统计了 %d 个任务，应为 1", got)
+	}
+
+	scheduler.mu.Lock()
+	retained := len(scheduler.tasks)
+	scheduler.mu.Unlock()
+	if retained != 1 {
+		t.Errorf("任务列表中还保存着 %d 个任务，清理的部分没有被去掉", retained)
+	}
+
+	// 幂等键随任务一起释放，可以重新提交
+	if _, err := scheduler.Submit(noop, TaskOptions{Key: "日报"}); err != nil {
+		t.Errorf("任务清理后重新提交相同幂等键出错: %v", err)
+	}
+}
+
+func TestServiceModeKeepsRunningTasks(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetClock(clock)
+	scheduler.SetHistory(time.Minute)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	release := make(chan struct{})
+	running, _ := scheduler.Submit(func(ctx context.Context) error {
+		<-release
+		return nil
+	}, TaskOptions{})
+	done, _ := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{})
+	scheduler.Wait(done)
+
+	clock.Advance(2 * time.Minute)
+	scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{})
+
+	// 运行中的任务不会被清理，它之后已结束的任务照常清理
+	if _, err := scheduler.TaskInfo(running); err != nil {
+		t.Errorf("运行中的任务被清理: %v", err)
+	}
+	if _, err := scheduler.TaskInfo(done); !errors.Is(err, ErrTaskEvicted) {
+		t.Errorf("已结束的任务返回 %v，应为 ErrTaskEvicted", err)
+	}
+	close(release)
+	if result, err := scheduler.Wait(running); err != nil || !result.Success {
+		t.Errorf("运行中的任务结果为 %+v，错误 %v", result, err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 暂停分发：排队中的任务保留在队列里，运行中的任务继续执行
+// 暂停期间 Drain 会一直等到 Resume；Stop、Cancel 和 Shutdown 不受暂停影响
+func (ts *TaskScheduler) Pause() {
+	if !ts.paused.Swap(true) {
+		ts.logf("   [调度器] 暂停分发\n")
+	}
+}
+
+// 恢复分发
+func (ts *TaskScheduler) Resume() {
+	if ts.paused.Swap(false) {
+		ts.logf("   [调度器] 恢复分发\n")
+	}
+
+	ts.mu.Lock()
+	queue := ts.queue
+	ts.mu.Unlock()
+	if queue != nil {
+		queue.wake()
+	}
+}
+
+// 是否处于暂停状态
+func (ts *TaskScheduler) Paused() bool {
+	return ts.paused.Load()
+}
+
+// 优雅停止：不再分发排队中的任务，在 grace 内等待运行中的任务结束，
+// 之后取消剩下的任务并等待全部结束。运行中的任务都在 grace 内结束时返回 true
+// 批量执行和服务模式都可以使用，批量执行的摘要中会列出未开始的任务
+// 等待时间使用调度器的时钟；停止期间暂停分发，结束后恢复为调用前的暂停状态
+func (ts *TaskScheduler) Shutdown(grace time.Duration) bool {
+	ts.stopRecurring()
+
+	ts.mu.Lock()
+	if !ts.running {
+		ts.mu.Unlock()
+		return true
+	}
+	ts.accepting = false
+	wasPaused := ts.paused.Swap(true)
+
+	// 等待运行中的任务结束
+	idle := make(chan struct{})
+	go func() {
+		ts.mu.Lock()
+		for ts.busy > 0 {
+			ts.idle.Wait()
+		}
+		ts.mu.Unlock()
+		close(idle)
+	}()
+	ts.mu.Unlock()
+
+	graceful := true
+	timer := ts.clock.NewTimer(grace)
+	select {
+	case <-idle:
+		timer.Stop()
+	case <-timer.C():
+		graceful = false
+		ts.logf("   [调度器] 等待超过 %v，取消剩下的任务\n", grace)
+	}
+
+	ts.Cancel()
+	ts.Drain()
+	ts.paused.Store(wasPaused)
+	return graceful
+}
+
+// 收到 SIGINT 或 SIGTERM 时优雅停止调度器，第二次收到信号时立即取消所有任务
+// 返回的函数用于取消监听
+func (ts *TaskScheduler) NotifyShutdown(grace time.Duration) (stop func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		select {
+		case sig := <-signals:
+			ts.logf("   [调度器] 收到信号 %v，最多等待 %v 让运行中的任务结束\n", sig, grace)
+			go ts.Shutdown(grace)
+		case <-done:
+			return
+		}
+
+		select {
+		case sig := <-signals:
+			ts.logf("   [调度器] 再次收到信号 %v，立即取消所有任务\n", sig)
+			ts.Cancel()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+func demoShutdown() {
+	fmt.Println("演示23：暂停、恢复与优雅停止")
+
+	scheduler := NewTaskScheduler(2)
+	scheduler.Start()
+	for i := 1; i <= 4; i++ {
+		name := fmt.Sprintf("上传%d", i)
+		scheduler.Submit(sleepStep(name, 100*time.Millisecond, nil), TaskOptions{Name: name})
+	}
+	time.Sleep(50 * time.Millisecond)
+	scheduler.Pause()
+	// 暂停后正在上传的两个任务会执行完，剩下的留在队列中
+	time.Sleep(200 * time.Millisecond)
+	scheduler.Resume()
+	scheduler.Drain()
+
+	// 批量执行中收到 SIGINT：运行中的任务在宽限期内结束，其余任务不再开始
+	scheduler = NewTaskScheduler(2)
+	for i := 1; i <= 6; i++ {
+		name := fmt.Sprintf("迁移%d", i)
+		scheduler.AddTaskWithOptions(sleepStep(name, 200*time.Millisecond, nil), TaskOptions{Name: name})
+	}
+	stop := scheduler.NotifyShutdown(300 * time.Millisecond)
+	defer stop()
+
+	time.AfterFunc(300*time.Millisecond, func() {
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(os.Interrupt)
+		}
+	})
+	scheduler.RunParallel()
+}
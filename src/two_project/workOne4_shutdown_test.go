@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPauseKeepsTasksQueuedUntilResume(t *testing.T) {
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	scheduler.Pause()
+	started := make(chan struct{})
+	taskID, _ := scheduler.Submit(func(ctx context.Context) error {
+		close(started)
+		return nil
+	}, TaskOptions{})
+
+	select {
+	case <-started:
+		t.Fatal("暂停期间任务开始执行")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if info, _ := scheduler.TaskInfo(taskID); info.State != "queued" {
+		t.Errorf("暂停期间任务状态为 %s，应为 queued", info.State)
+	}
+
+	scheduler.Resume()
+	if result, _ := scheduler.Wait(taskID); !result.Success {
+		t.Errorf("恢复后任务结果为 %s: %v", result.Status, result.Error)
+	}
+	if scheduler.Paused() {
+		t.Error("恢复后仍处于暂停状态")
+	}
+}
+
+func TestShutdownCancelsAfterGrace(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetClock(clock)
+	scheduler.Start()
+
+	started := make(chan struct{})
+	running, _ := scheduler.Submit(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, TaskOptions{})
+	queued, _ := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{})
+	<-started
+
+	graceful := make(chan bool)
+	go func() { graceful <- scheduler.Shutdown(time.Minute) }()
+
+	// 等待时间按调度器的时钟计算，虚拟时间不前进就一直等
+	clock.BlockUntil(1)
+	select {
+	case <-graceful:
+		t.Fatal("等待时间还没到 Shutdown 就返回了")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(time.Minute)
+	if <-graceful {
+		t.Error("运行中的任务没有结束，Shutdown 应返回 false")
+	}
+
+	if result, _ := scheduler.Wait(running); result.Status != StatusCancelled {
+		t.Errorf("超过等待时间的任务状态为 %s，应为已取消", result.Status)
+	}
+	if result, _ := scheduler.Wait(queued); result.Status == StatusSuccess {
+		t.Error("停止时排队的任务不应再开始执行")
+	}
+	if _, err := scheduler.Submit(func(ctx context.Context) error { return nil }, TaskOptions{}); !errors.Is(err, ErrSchedulerStopped) {
+		t.Errorf("停止后提交返回 %v，应为 ErrSchedulerStopped", err)
+	}
+}
+
+func TestShutdownWithinGraceKeepsPauseState(t *testing.T) {
+	for _, paused := range []bool{false, true} {
+		scheduler := NewTaskScheduler(1)
+		scheduler.SetQuiet(true)
+		scheduler.Start()
+
+		taskID, _ := scheduler.Submit(func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}, TaskOptions{})
+		scheduler.Wait(taskID)
+		if paused {
+			scheduler.Pause()
+		}
+
+		if !scheduler.Shutdown(time.Second) {
+			t.Error("没有运行中的任务时 Shutdown 应返回 true")
+		}
+		if scheduler.Paused() != paused {
+			t.Errorf("调用前暂停状态为 %v，Shutdown 后变成了 %v", paused, scheduler.Paused())
+		}
+	}
+}
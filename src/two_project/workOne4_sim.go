@@ -0,0 +1,537 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrSimulationBatchOnly = errors.New("模拟模式只支持 RunSerial 和 RunParallel")
+
+// 任务上下文中携带的时钟和随机数
+type taskEnvKey struct{}
+
+type taskEnv struct {
+	clock  Clock        // nil 表示系统时间
+	pool   forkPool     // Fork 子任务使用的队列，nil 表示同步执行
+	worker *stealWorker // 执行任务的 worker 的本地队列
+	seed   int64
+	once   sync.Once
+	rand   *rand.Rand
+}
+
+// 为任务准备上下文：模拟模式下带上虚拟时钟，随机数种子由模拟种子和任务ID决定
+func (ts *TaskScheduler) taskContext(ctx context.Context, taskID int) context.Context {
+	env := &taskEnv{seed: time.Now().UnixNano() + int64(taskID)}
+	if fw, ok := ctx.Value(forkWorkerKey{}).(forkWorker); ok {
+		env.pool, env.worker = fw.pool, fw.worker
+	}
+	if ts.sim != nil {
+		env.clock = ts.sim
+		env.seed = ts.sim.seed*1_000_003 + int64(taskID)
+	}
+	return context.WithValue(ctx, taskEnvKey{}, env)
+}
+
+func clockFrom(ctx context.Context) Clock {
+	if env, ok := ctx.Value(taskEnvKey{}).(*taskEnv); ok && env.clock != nil {
+		return env.clock
+	}
+	return realClock{}
+}
+
+// 任务看到的当前时间，模拟模式下为虚拟时间
+func Now(ctx context.Context) time.Time {
+	return clockFrom(ctx).Now()
+}
+
+// 任务使用的随机数，模拟模式下每次运行得到相同的序列
+// 返回的 *rand.Rand 属于当前任务，不能在多个协程中同时使用
+func RandFrom(ctx context.Context) *rand.Rand {
+	env, ok := ctx.Value(taskEnvKey{}).(*taskEnv)
+	if !ok {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	env.once.Do(func() { env.rand = rand.New(rand.NewSource(env.seed)) })
+	return env.rand
+}
+
+// 等待一段时间，上下文取消时提前返回取消的原因
+// 模拟模式下按虚拟时间等待，不占用真实时间，任务需要等待时都应该使用它或 WaitDone
+func Sleep(ctx context.Context, d time.Duration) error {
+	clock := clockFrom(ctx)
+	if sim, ok := clock.(*Simulation); ok {
+		return sim.sleep(ctx, d)
+	}
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 等待上下文被取消（超时、CancelTask 或取消整次运行），返回取消的原因
+// 与 <-ctx.Done() 相同，但模拟模式下会把控制权交回模拟器，任务只能用它等待取消
+func WaitDone(ctx context.Context) error {
+	if sim, ok := clockFrom(ctx).(*Simulation); ok {
+		return sim.waitDone(ctx)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// 带超时的上下文，模拟模式下按虚拟时间计时
+func withTimeoutCause(ctx context.Context, d time.Duration, cause error) (context.Context, context.CancelFunc) {
+	sim, ok := clockFrom(ctx).(*Simulation)
+	if !ok {
+		return context.WithTimeoutCause(ctx, d, cause)
+	}
+
+	inner, cancel := context.WithCancelCause(ctx)
+	timeoutCtx := &simTimeoutCtx{Context: inner, deadline: sim.Now().Add(d)}
+	event := sim.after(d, func() {
+		timeoutCtx.expired.Store(true)
+		cancel(cause)
+	})
+	return timeoutCtx, func() {
+		sim.stop(event)
+		cancel(context.Canceled)
+	}
+}
+
+// 虚拟时间到期的上下文，和 context.WithTimeout 一样返回 DeadlineExceeded
+type simTimeoutCtx struct {
+	context.Context
+	deadline time.Time
+	expired  atomic.Bool
+}
+
+func (c *simTimeoutCtx) Deadline() (time.Time, bool) { return c.deadline, true }
+
+func (c *simTimeoutCtx) Err() error {
+	err := c.Context.Err()
+	if err != nil && c.expired.Load() {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// 模拟器中的定时事件
+type simEvent struct {
+	at      time.Time
+	seq     int64
+	fire    func()
+	stopped bool
+}
+
+// 按时间排序的事件堆，时间相同时先安排的先触发
+type eventHeap []*simEvent
+
+func (h eventHeap) Len() int { return len(h) }
+
+func (h eventHeap) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *eventHeap) Push(x any) { *h = append(*h, x.(*simEvent)) }
+
+func (h *eventHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// 模拟器中执行任务的协程
+type simProc struct {
+	yield    chan struct{} // 协程等待或结束时交回控制权
+	finished bool
+}
+
+type simProcKey struct{}
+
+// 在 Sleep 或 WaitDone 中等待的任务
+type simSleeper struct {
+	ctx   context.Context
+	proc  *simProc
+	event *simEvent // WaitDone 没有唤醒事件，为 nil
+	wake  chan struct{}
+}
+
+// 确定性模拟：虚拟时钟 + 固定的随机种子
+//
+// 每个任务仍然在自己的协程中执行，但同一时刻只有一个协程在运行：
+// 任务调用 Sleep 或结束时把控制权交回模拟器，模拟器再把虚拟时间推进到下一个事件。
+// 因此只要任务只通过 Sleep 和 WaitDone 等待、只使用 RandFrom 产生随机数，
+// 同一个种子下超时、重试和执行顺序都完全相同，整次运行只需要几毫秒真实时间。
+// 等待取消的任务使用 WaitDone，模拟器在推进虚拟时间时发现上下文取消再唤醒它。
+// 任务是否在等待只取决于它调用了什么，与真实时间无关：
+// 计算很慢的任务只会让模拟变慢，不会改变结果；直接读 ctx.Done() 的任务不交回控制权，
+// 模拟器会一直等它，直到它的上下文从模拟器之外被取消。
+type Simulation struct {
+	seed int64
+
+	mu       sync.Mutex // 保护下面的字段，模拟器之外的协程也可能调用 Now 和 NewTimer
+	now      time.Time
+	seq      int64
+	events   eventHeap
+	sleepers []*simSleeper // 等待中的任务，按开始等待的顺序
+
+	// 只由模拟器协程访问
+	ctx     context.Context // 本次运行的上下文
+	workers int             // 虚拟 worker 数
+	busy    int
+	retryAt time.Time // 已安排的限流重试时间
+}
+
+// 创建模拟器，虚拟时间从 2024-01-01 00:00:00 UTC 开始
+func NewSimulation(seed int64) *Simulation {
+	return &Simulation{
+		seed: seed,
+		now:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// 开启模拟模式，需要在执行前调用
+// 调度器的时钟也会换成虚拟时钟，只支持 RunSerial 和 RunParallel
+func (ts *TaskScheduler) SetSimulation(sim *Simulation) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.sim = sim
+	ts.clock = sim
+}
+
+func (s *Simulation) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.now
+}
+
+// 虚拟定时器，在模拟器推进到到期时间时触发
+func (s *Simulation) NewTimer(d time.Duration) ClockTimer {
+	t := &simTimer{sim: s, ch: make(chan time.Time, 1)}
+	t.event = s.after(d, func() {
+		s.mu.Lock()
+		t.fired = true
+		now := s.now
+		s.mu.Unlock()
+		t.ch <- now
+	})
+	return t
+}
+
+type simTimer struct {
+	sim   *Simulation
+	ch    chan time.Time
+	event *simEvent
+	fired bool
+}
+
+func (t *simTimer) C() <-chan time.Time { return t.ch }
+
+func (t *simTimer) Stop() bool {
+	t.sim.mu.Lock()
+	defer t.sim.mu.Unlock()
+
+	active := !t.fired && !t.event.stopped
+	t.event.stopped = true
+	return active
+}
+
+// 安排 d 之后触发的事件
+func (s *Simulation) after(d time.Duration, fire func()) *simEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	event := &simEvent{at: s.now.Add(max(d, 0)), seq: s.seq, fire: fire}
+	heap.Push(&s.events, event)
+	return event
+}
+
+// 停止还没触发的事件
+func (s *Simulation) stop(event *simEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.stopped = true
+}
+
+// 取出下一个没有被停止的事件，并把虚拟时间推进到它的触发时间
+func (s *Simulation) next() *simEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.events) > 0 {
+		event := heap.Pop(&s.events).(*simEvent)
+		if !event.stopped {
+			s.now = event.at
+			return event
+		}
+	}
+	return nil
+}
+
+// 在新协程中执行 fn，直到它第一次等待或结束
+func (s *Simulation) spawn(ctx context.Context, fn func(ctx context.Context)) {
+	p := &simProc{yield: make(chan struct{})}
+	ctx = context.WithValue(ctx, simProcKey{}, p)
+	go func() {
+		fn(ctx)
+		s.mu.Lock()
+		p.finished = true
+		s.mu.Unlock()
+		p.yield <- struct{}{}
+	}()
+	s.await(p)
+}
+
+// 等待协程交回控制权
+func (s *Simulation) await(p *simProc) {
+	<-p.yield
+	s.mu.Lock()
+	finished := p.finished
+	s.mu.Unlock()
+	if finished {
+		s.busy--
+	}
+}
+
+// 唤醒等待中的任务，直到它再次等待或结束
+func (s *Simulation) resume(sleeper *simSleeper) {
+	s.mu.Lock()
+	s.sleepers = slices.DeleteFunc(s.sleepers, func(other *simSleeper) bool { return other == sleeper })
+	s.mu.Unlock()
+
+	close(sleeper.wake)
+	s.await(sleeper.proc)
+}
+
+// 任务协程中调用：登记唤醒事件后把控制权交回模拟器
+func (s *Simulation) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil || d <= 0 {
+		return err
+	}
+
+	p, ok := ctx.Value(simProcKey{}).(*simProc)
+	if !ok {
+		// 不是模拟器启动的协程，只能等待虚拟定时器，不交出控制权
+		timer := s.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	sleeper := &simSleeper{ctx: ctx, proc: p, wake: make(chan struct{})}
+	sleeper.event = s.after(d, func() { s.resume(sleeper) })
+	return s.suspend(sleeper)
+}
+
+// 任务协程中调用：登记为等待取消的任务后把控制权交回模拟器
+func (s *Simulation) waitDone(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p, ok := ctx.Value(simProcKey{}).(*simProc)
+	if !ok {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return s.suspend(&simSleeper{ctx: ctx, proc: p, wake: make(chan struct{})})
+}
+
+// 交出控制权，直到模拟器唤醒这个任务
+func (s *Simulation) suspend(sleeper *simSleeper) error {
+	s.mu.Lock()
+	s.sleepers = append(s.sleepers, sleeper)
+	s.mu.Unlock()
+
+	sleeper.proc.yield <- struct{}{}
+	<-sleeper.wake
+	return sleeper.ctx.Err()
+}
+
+// 上下文被取消（超时、CancelTask 或取消整次运行）的任务立即醒来
+func (s *Simulation) wakeCancelled() {
+	for {
+		s.mu.Lock()
+		if i := slices.IndexFunc(s.sleepers, func(sleeper *simSleeper) bool { return sleeper.ctx.Err() != nil }); i >= 0 {
+			sleeper := s.sleepers[i]
+			if sleeper.event != nil {
+				sleeper.event.stopped = true
+			}
+			s.mu.Unlock()
+			s.resume(sleeper)
+			continue
+		}
+		s.mu.Unlock()
+		return
+	}
+}
+
+// 由 startWorkers 调用，记录本次运行的上下文和虚拟 worker 数
+func (s *Simulation) start(ctx context.Context, workers int) {
+	s.ctx = ctx
+	s.workers = workers
+	s.busy = 0
+	s.retryAt = time.Time{}
+}
+
+// 执行所有任务：空闲的 worker 取任务执行，没有可以运行的协程时推进到下一个事件
+func (s *Simulation) run(ts *TaskScheduler) {
+	ts.mu.Lock()
+	queue := ts.queue
+	ts.mu.Unlock()
+
+	admit := ts.admitFunc(s.ctx)
+	s.loop(ts, queue, admit)
+
+	// 没有事件但还有任务没结束，说明剩下的任务在等待不会到来的取消，取消它们
+	if n := ts.unfinished(); n > 0 {
+		ts.logf("   [模拟] 虚拟时间已无法推进，取消剩下的 %d 个任务\n", n)
+		ts.Cancel()
+		// 取消后放回被限流的任务，让它们立即以取消结束
+		queue.wake()
+		s.loop(ts, queue, admit)
+	}
+}
+
+func (s *Simulation) loop(ts *TaskScheduler, queue *readyQueue, admit admitFunc) {
+	for {
+		s.wakeCancelled()
+		for s.busy < s.workers {
+			item, retryAt := queue.tryPop(admit)
+			if item == nil {
+				s.scheduleRetry(retryAt)
+				break
+			}
+			s.busy++
+			s.spawn(s.ctx, func(ctx context.Context) {
+				ts.runItem(ctx, queue, item)
+			})
+			s.wakeCancelled()
+		}
+
+		event := s.next()
+		if event == nil {
+			return
+		}
+		event.fire()
+	}
+}
+
+// 被限流的任务在令牌可用时重新检查
+func (s *Simulation) scheduleRetry(at time.Time) {
+	now := s.Now()
+	if at.IsZero() || !s.retryAt.IsZero() && !s.retryAt.After(at) && s.retryAt.After(now) {
+		return
+	}
+	s.retryAt = at
+	s.after(at.Sub(now), func() {})
+}
+
+// 还没结束的任务数
+func (ts *TaskScheduler) unfinished() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	n := 0
+	for _, entry := range ts.tasks {
+		if entry != nil && entry.state != stateDone {
+			n++
+		}
+	}
+	return n
+}
+
+// 用于演示的结果轨迹，时间相对虚拟时钟的起点
+func simTrace(scheduler *TaskScheduler, origin time.Time) string {
+	var b strings.Builder
+	for _, result := range scheduler.GetResults() {
+		fmt.Fprintf(&b, "  %s [%s] 尝试 %d 次，+%v ~ +%v",
+			taskLabel(result), result.Status, len(result.Attempts), result.StartTime.Sub(origin), result.EndTime.Sub(origin))
+		if result.Error != nil {
+			fmt.Fprintf(&b, "，%v", result.Error)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func demoSimulation() {
+	fmt.Println("演示26：确定性模拟")
+
+	// 以分钟计的任务：超时、带抖动的重试、随机失败和依赖
+	run := func(seed int64) (string, time.Duration, time.Duration) {
+		sim := NewSimulation(seed)
+		origin := sim.Now()
+		scheduler := NewTaskScheduler(2)
+		scheduler.SetQuiet(true)
+		scheduler.SetSimulation(sim)
+		scheduler.SetTimeout(10 * time.Minute)
+		scheduler.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, Jitter: 0.5})
+
+		flaky := func(name string, d time.Duration) ContextTask {
+			return func(ctx context.Context) error {
+				if err := Sleep(ctx, d); err != nil {
+					return err
+				}
+				if RandFrom(ctx).Intn(2) == 0 {
+					return fmt.Errorf("%s 随机失败", name)
+				}
+				return nil
+			}
+		}
+		download, _ := scheduler.AddTaskWithOptions(flaky("下载", 3*time.Minute), TaskOptions{Name: "下载"})
+		scheduler.AddTaskWithOptions(flaky("解析", 5*time.Minute), TaskOptions{Name: "解析", DependsOn: []int{download}})
+		scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+			return Sleep(ctx, time.Hour)
+		}, TaskOptions{Name: "卡住的导出"})
+		scheduler.AddTaskWithOptions(flaky("校验", 2*time.Minute), TaskOptions{Name: "校验", Priority: 5})
+
+		start := time.Now()
+		scheduler.RunParallel()
+		return simTrace(scheduler, origin), scheduler.Summary().Makespan, time.Since(start)
+	}
+
+	first, makespan, elapsed := run(42)
+	fmt.Print(first)
+	fmt.Printf("虚拟时间 %v，真实耗时 %v\n", makespan, elapsed.Round(time.Millisecond))
+	again, _, _ := run(42)
+	fmt.Printf("同一种子再运行一次，结果完全相同: %v\n", again == first)
+	other, _, _ := run(7)
+	fmt.Printf("换一个种子，结果不同: %v\n", other != first)
+
+	fmt.Println("演示1 的示例任务在模拟模式下执行:")
+	scheduler := NewTaskScheduler(3)
+	scheduler.SetSimulation(NewSimulation(1))
+	scheduler.AddContextTasks(createSampleTasks())
+	scheduler.RunParallel()
+}
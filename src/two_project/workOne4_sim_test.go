@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 模拟模式下运行调度器，超过 limit 真实时间仍未结束时失败
+func runSimulated(t *testing.T, scheduler *TaskScheduler, limit time.Duration) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		scheduler.RunParallel()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(limit):
+		t.Fatalf("模拟运行 %v 内没有结束", limit)
+	}
+}
+
+func TestSimulationWaitDoneTimeout(t *testing.T) {
+	sim := NewSimulation(1)
+	origin := sim.Now()
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetSimulation(sim)
+	scheduler.SetTimeout(time.Minute)
+	scheduler.AddContextTask(WaitDone)
+	scheduler.AddContextTask(func(ctx context.Context) error {
+		return Sleep(ctx, 30*time.Second)
+	})
+
+	runSimulated(t, scheduler, 5*time.Second)
+
+	results := scheduler.GetResults()
+	if got := results[0].Status; got != StatusTimeout {
+		t.Fatalf("WaitDone 的任务状态为 %s，应为超时", got)
+	}
+	if !errors.Is(results[0].Error, ErrTaskTimeout) {
+		t.Errorf("超时任务的错误为 %v，应为 ErrTaskTimeout", results[0].Error)
+	}
+	if got := results[0].EndTime.Sub(origin); got != time.Minute {
+		t.Errorf("超时任务在虚拟时间 +%v 结束，应为 +1m0s", got)
+	}
+	if got := results[1].EndTime.Sub(origin); !results[1].Success || got != 30*time.Second {
+		t.Errorf("Sleep 任务 success=%v，在 +%v 结束，应在 +30s 成功", results[1].Success, got)
+	}
+}
+
+func TestSimulationCancelsWaitDoneWithoutEvents(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	scheduler.SetSimulation(NewSimulation(1))
+	blocked, _ := scheduler.AddTaskWithOptions(WaitDone, TaskOptions{Name: "阻塞"})
+	scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+		return Sleep(ctx, time.Second)
+	}, TaskOptions{Name: "后续"})
+
+	// 没有超时也没有其他事件时，模拟器取消卡住的任务，后续任务仍然执行
+	runSimulated(t, scheduler, 5*time.Second)
+
+	results := scheduler.GetResults()
+	if results[blocked].Status != StatusCancelled {
+		t.Errorf("阻塞任务状态为 %s，应为取消", results[blocked].Status)
+	}
+}
+
+func TestSimulationSlowTaskKeepsVirtualSchedule(t *testing.T) {
+	sim := NewSimulation(1)
+	origin := sim.Now()
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetSimulation(sim)
+
+	// 计算需要较长真实时间的任务不会被当成在等待，虚拟时间在它交回控制权前不推进
+	slow, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+		}
+		return Sleep(ctx, time.Second)
+	}, TaskOptions{Name: "慢任务"})
+	quick, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error {
+		return Sleep(ctx, 500*time.Millisecond)
+	}, TaskOptions{Name: "快任务"})
+
+	runSimulated(t, scheduler, 5*time.Second)
+
+	results := scheduler.GetResults()
+	if got := results[slow].EndTime.Sub(origin); got != time.Second {
+		t.Errorf("慢任务在虚拟时间 +%v 结束，应为 +1s", got)
+	}
+	if got := results[quick].EndTime.Sub(origin); got != 500*time.Millisecond {
+		t.Errorf("快任务在虚拟时间 +%v 结束，应为 +500ms", got)
+	}
+}
+
+func TestSimulationReplaysWithSameSeed(t *testing.T) {
+	run := func(seed int64) []TaskResult {
+		scheduler := NewTaskScheduler(2)
+		scheduler.SetQuiet(true)
+		scheduler.SetSimulation(NewSimulation(seed))
+		scheduler.SetTimeout(time.Minute)
+		scheduler.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, Jitter: 0.5})
+		for i := 0; i < 6; i++ {
+			scheduler.AddContextTask(func(ctx context.Context) error {
+				if err := Sleep(ctx, time.Duration(RandFrom(ctx).Intn(90))*time.Second); err != nil {
+					return err
+				}
+				if RandFrom(ctx).Intn(2) == 0 {
+					return errors.New("随机失败")
+				}
+				return nil
+			})
+		}
+		runSimulated(t, scheduler, 5*time.Second)
+		return scheduler.GetResults()
+	}
+
+	first, second := run(42), run(42)
+	for i := range first {
+		a, b := first[i], second[i]
+		if a.Status != b.Status || len(a.Attempts) != len(b.Attempts) || !a.StartTime.Equal(b.StartTime) || !a.EndTime.Equal(b.EndTime) {
+			t.Errorf("任务 %d 两次运行结果不同: %s %d 次 %v~%v / %s %d 次 %v~%v", i+1,
+				a.Status, len(a.Attempts), a.StartTime, a.EndTime, b.Status, len(b.Attempts), b.StartTime, b.EndTime)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 摘要中列出的最慢任务数量
+const slowestCount = 5
+
+// 执行摘要
+type Summary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Panicked  int
+	Rejected  int // 因熔断未执行的任务数
+
+	Makespan      time.Duration // 从开始运行到结束的墙钟时间
+	TotalDuration time.Duration // 所有任务耗时之和，即串行执行大约需要的时间
+	Speedup       float64       // 相对串行执行的加速比
+	Throughput    float64       // 每秒完成的任务数
+
+	// 实际执行过的任务的耗时分布，没有开始执行的任务不计入
+	AvgDuration time.Duration
+	P50         time.Duration
+	P90         time.Duration
+	P99         time.Duration
+	MaxDuration time.Duration
+
+	ThrottleWait  time.Duration // 所有任务的限流等待之和
+	AdmissionWait time.Duration // 所有任务等待资源的时间之和
+	SuccessRate   float64       // 百分比
+	Slowest       []TaskResult  // 耗时最长的几个任务
+	Results       []TaskResult
+
+	Tenants            []TenantSummary     // 按租户汇总
+	BreakerTransitions []BreakerTransition // 本次运行中分组熔断器的状态变化
+	NeverStarted       []TaskResult        // 没有开始执行的任务，例如停止时还在排队的任务
+}
+
+// 统计所有已结束任务的结果，服务模式下排队和运行中的任务不计入
+func (ts *TaskScheduler) summaryLocked() Summary {
+	summary := Summary{BreakerTransitions: ts.breakers.history()}
+	for _, entry := range ts.tasks {
+		if entry != nil && entry.state == stateDone {
+			summary.Results = append(summary.Results, entry.result)
+		}
+	}
+	summary.Total = len(summary.Results)
+	summary.Tenants = ts.tenantSummaryLocked(summary.Results)
+
+	var executed []TaskResult
+	for _, result := range summary.Results {
+		summary.TotalDuration += result.Duration
+		summary.ThrottleWait += result.ThrottleWait
+		summary.AdmissionWait += result.AdmissionWait
+		if result.Success {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+		switch result.Status {
+		case StatusPanicked:
+			summary.Panicked++
+		case StatusRejected:
+			summary.Rejected++
+		}
+		if result.Started {
+			executed = append(executed, result)
+		} else {
+			summary.NeverStarted = append(summary.NeverStarted, result)
+		}
+	}
+
+	// 墙钟时间从启动 worker 算起，运行中时算到现在
+	if !ts.startedAt.IsZero() {
+		end := ts.stoppedAt
+		if ts.running || end.IsZero() {
+			end = ts.clock.Now()
+		}
+		summary.Makespan = end.Sub(ts.startedAt)
+	}
+	if summary.Makespan > 0 {
+		summary.Speedup = float64(summary.TotalDuration) / float64(summary.Makespan)
+		summary.Throughput = float64(summary.Total) / summary.Makespan.Seconds()
+	}
+	if summary.Total > 0 {
+		summary.SuccessRate = float64(summary.Succeeded) / float64(summary.Total) * 100
+	}
+
+	if len(executed) > 0 {
+		sort.SliceStable(executed, func(i, j int) bool {
+			return executed[i].Duration > executed[j].Duration
+		})
+		var executedTotal time.Duration
+		for _, result := range executed {
+			executedTotal += result.Duration
+		}
+		summary.AvgDuration = executedTotal / time.Duration(len(executed))
+		summary.P50 = percentile(executed, 50)
+		summary.P90 = percentile(executed, 90)
+		summary.P99 = percentile(executed, 99)
+		summary.MaxDuration = executed[0].Duration
+		summary.Slowest = executed[:min(slowestCount, len(executed))]
+	}
+	return summary
+}
+
+// 最近秩法计算分位数，results 需要按耗时从大到小排好序
+func percentile(results []TaskResult, p int) time.Duration {
+	return results[len(results)-max(percentileRank(len(results), p), 1)].Duration
+}
+
+// 第 p 百分位在 n 个从小到大排列的值中的秩
+func percentileRank(n, p int) int {
+	return (p*n + 99) / 100
+}
+
+// 统计当前的执行摘要
+func (ts *TaskScheduler) Summary() Summary {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.summaryLocked()
+}
+
+func taskLabel(result TaskResult) string {
+	if result.Name != "" {
+		return fmt.Sprintf("任务 %d(%s)", result.TaskID+1, result.Name)
+	}
+	return fmt.Sprintf("任务 %d", result.TaskID+1)
+}
+
+// 以文本形式输出摘要
+func (s Summary) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "\n=== 执行摘要 ===\n")
+	fmt.Fprintf(w, "总任务数: %d\n", s.Total)
+	if s.Total == 0 {
+		_, err := fmt.Fprintf(w, "没有任务\n\n")
+		return err
+	}
+
+	fmt.Fprintf(w, "成功: %d\n", s.Succeeded)
+	fmt.Fprintf(w, "失败: %d\n", s.Failed)
+	if s.Panicked > 0 {
+		fmt.Fprintf(w, "其中崩溃: %d\n", s.Panicked)
+	}
+	if s.Rejected > 0 {
+		fmt.Fprintf(w, "其中熔断: %d\n", s.Rejected)
+	}
+	fmt.Fprintf(w, "实际耗时: %v\n", s.Makespan)
+	fmt.Fprintf(w, "累计耗时: %v\n", s.TotalDuration)
+	if s.Makespan > 0 {
+		fmt.Fprintf(w, "加速比: %.2fx\n", s.Speedup)
+		fmt.Fprintf(w, "吞吐量: %.2f 个任务/秒\n", s.Throughput)
+	}
+	fmt.Fprintf(w, "平均耗时: %v\n", s.AvgDuration)
+	fmt.Fprintf(w, "耗时分布: p50 %v / p90 %v / p99 %v / 最大 %v\n", s.P50, s.P90, s.P99, s.MaxDuration)
+	if s.ThrottleWait > 0 {
+		fmt.Fprintf(w, "限流等待: %v\n", s.ThrottleWait)
+	}
+	if s.AdmissionWait > 0 {
+		fmt.Fprintf(w, "资源等待: %v\n", s.AdmissionWait)
+	}
+	if len(s.Slowest) > 1 {
+		fmt.Fprintf(w, "最慢的任务:\n")
+		for _, result := range s.Slowest {
+			fmt.Fprintf(w, "  %s %v\n", taskLabel(result), result.Duration)
+		}
+	}
+	if len(s.NeverStarted) > 0 {
+		fmt.Fprintf(w, "未开始的任务: %d\n", len(s.NeverStarted))
+		for _, result := range s.NeverStarted {
+			fmt.Fprintf(w, "  %s [%s]\n", taskLabel(result), result.Status)
+		}
+	}
+	if len(s.Tenants) > 1 || len(s.Tenants) == 1 && s.Tenants[0].Tenant != "" {
+		fmt.Fprintf(w, "租户:\n")
+		writeTenants(w, s.Tenants)
+	}
+	if len(s.BreakerTransitions) > 0 {
+		fmt.Fprintf(w, "熔断状态变化:\n")
+		for _, t := range s.BreakerTransitions {
+			fmt.Fprintf(w, "  %s 分组 %s: %s -> %s（任务 %d）\n", t.Time.Format("15:04:05.000"), t.Group, t.From, t.To, t.TaskID+1)
+		}
+	}
+	_, err := fmt.Fprintf(w, "成功率: %.1f%%\n\n", s.SuccessRate)
+	return err
+}
+
+// 报告中的单个任务，时长单位为毫秒
+type taskReport struct {
+	TaskID      int       `json:"task_id"`
+	Name        string    `json:"name,omitempty"`
+	Group       string    `json:"group,omitempty"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Status      string    `json:"status"`
+	Success     bool      `json:"success"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	DurationMs  float64   `json:"duration_ms"`
+	QueueWaitMs float64   `json:"queue_wait_ms"`
+	ThrottleMs  float64   `json:"throttle_ms"`
+	AdmissionMs float64   `json:"admission_ms"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error,omitempty"`
+}
+
+func newTaskReport(result TaskResult) taskReport {
+	return taskReport{
+		TaskID:      result.TaskID + 1,
+		Name:        result.Name,
+		Group:       result.Group,
+		Tenant:      result.Tenant,
+		Status:      result.Status.String(),
+		Success:     result.Success,
+		StartTime:   result.StartTime,
+		EndTime:     result.EndTime,
+		DurationMs:  millis(result.Duration),
+		QueueWaitMs: millis(result.QueueWait),
+		ThrottleMs:  millis(result.ThrottleWait),
+		AdmissionMs: millis(result.AdmissionWait),
+		Attempts:    len(result.Attempts),
+		Error:       errorString(result.Error),
+	}
+}
+
+// 结构化的摘要报告
+type summaryReport struct {
+	Total           int          `json:"total"`
+	Succeeded       int          `json:"succeeded"`
+	Failed          int          `json:"failed"`
+	Panicked        int          `json:"panicked"`
+	Rejected        int          `json:"rejected"`
+	SuccessRate     float64      `json:"success_rate"`
+	MakespanMs      float64      `json:"makespan_ms"`
+	TotalDurationMs float64      `json:"total_duration_ms"`
+	Speedup         float64      `json:"speedup"`
+	Throughput      float64      `json:"throughput_per_sec"`
+	AvgMs           float64      `json:"avg_ms"`
+	P50Ms           float64      `json:"p50_ms"`
+	P90Ms           float64      `json:"p90_ms"`
+	P99Ms           float64      `json:"p99_ms"`
+	MaxMs           float64      `json:"max_ms"`
+	ThrottleWaitMs  float64      `json:"throttle_wait_ms"`
+	AdmissionWaitMs float64      `json:"admission_wait_ms"`
+	Slowest         []taskReport `json:"slowest"`
+	Tasks           []taskReport `json:"tasks"`
+
+	Tenants            []tenantReport  `json:"tenants"`
+	BreakerTransitions []breakerReport `json:"breaker_transitions"`
+	NeverStarted       []int           `json:"never_started"`
+}
+
+type tenantReport struct {
+	Tenant         string  `json:"tenant"`
+	Weight         float64 `json:"weight"`
+	Total          int     `json:"total"`
+	Succeeded      int     `json:"succeeded"`
+	Queued         int     `json:"queued"`
+	PeakQueued     int     `json:"peak_queued"`
+	AvgLatencyMs   float64 `json:"avg_latency_ms"`
+	AvgQueueWaitMs float64 `json:"avg_queue_wait_ms"`
+	P90QueueWaitMs float64 `json:"p90_queue_wait_ms"`
+	MaxQueueWaitMs float64 `json:"max_queue_wait_ms"`
+}
+
+type breakerReport struct {
+	Group       string    `json:"group"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Time        time.Time `json:"time"`
+	TaskID      int       `json:"task_id"`
+	FailureRate float64   `json:"failure_rate,omitempty"`
+}
+
+// 以 JSON 输出摘要和每个任务的结果
+func (s Summary) WriteJSON(w io.Writer) error {
+	report := summaryReport{
+		Total:           s.Total,
+		Succeeded:       s.Succeeded,
+		Failed:          s.Failed,
+		Panicked:        s.Panicked,
+		Rejected:        s.Rejected,
+		SuccessRate:     s.SuccessRate,
+		MakespanMs:      millis(s.Makespan),
+		TotalDurationMs: millis(s.TotalDuration),
+		Speedup:         s.Speedup,
+		Throughput:      s.Throughput,
+		AvgMs:           millis(s.AvgDuration),
+		P50Ms:           millis(s.P50),
+		P90Ms:           millis(s.P90),
+		P99Ms:           millis(s.P99),
+		MaxMs:           millis(s.MaxDuration),
+		ThrottleWaitMs:  millis(s.ThrottleWait),
+		AdmissionWaitMs: millis(s.AdmissionWait),
+		Slowest:         []taskReport{},
+		Tasks:           []taskReport{},
+
+		Tenants:            []tenantReport{},
+		BreakerTransitions: []breakerReport{},
+		NeverStarted:       []int{},
+	}
+	for _, t := range s.Tenants {
+		report.Tenants = append(report.Tenants, tenantReport{
+			Tenant:         t.Tenant,
+			Weight:         t.Weight,
+			Total:          t.Total,
+			Succeeded:      t.Succeeded,
+			Queued:         t.Queued,
+			PeakQueued:     t.PeakQueued,
+			AvgLatencyMs:   millis(t.AvgLatency),
+			AvgQueueWaitMs: millis(t.AvgQueueWait),
+			P90QueueWaitMs: millis(t.P90QueueWait),
+			MaxQueueWaitMs: millis(t.MaxQueueWait),
+		})
+	}
+	for _, result := range s.NeverStarted {
+		report.NeverStarted = append(report.NeverStarted, result.TaskID+1)
+	}
+	for _, t := range s.BreakerTransitions {
+		report.BreakerTransitions = append(report.BreakerTransitions, breakerReport{
+			Group:       t.Group,
+			From:        t.From.String(),
+			To:          t.To.String(),
+			Time:        t.Time,
+			TaskID:      t.TaskID + 1,
+			FailureRate: t.FailureRate,
+		})
+	}
+	for _, result := range s.Slowest {
+		report.Slowest = append(report.Slowest, newTaskReport(result))
+	}
+	for _, result := range s.Results {
+		report.Tasks = append(report.Tasks, newTaskReport(result))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// 以 CSV 输出每个任务的结果，第一行为表头
+func (s Summary) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"task_id", "name", "group", "tenant", "status", "success", "start_time", "end_time",
+		"duration_ms", "queue_wait_ms", "throttle_ms", "admission_ms", "attempts", "error"})
+
+	formatMs := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	for _, result := range s.Results {
+		r := newTaskReport(result)
+		cw.Write([]string{
+			strconv.Itoa(r.TaskID),
+			r.Name,
+			r.Group,
+			r.Tenant,
+			r.Status,
+			strconv.FormatBool(r.Success),
+			r.StartTime.Format(time.RFC3339Nano),
+			r.EndTime.Format(time.RFC3339Nano),
+			formatMs(r.DurationMs),
+			formatMs(r.QueueWaitMs),
+			formatMs(r.ThrottleMs),
+			formatMs(r.AdmissionMs),
+			strconv.Itoa(r.Attempts),
+			r.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// 在收到摘要时输出结构化报告
+type SummaryReporter struct {
+	BaseObserver
+	w     io.Writer
+	write func(Summary, io.Writer) error
+}
+
+// 输出 JSON 格式的摘要报告
+func NewJSONSummaryReporter(w io.Writer) *SummaryReporter {
+	return &SummaryReporter{w: w, write: Summary.WriteJSON}
+}
+
+// 输出 CSV 格式的任务结果
+func NewCSVSummaryReporter(w io.Writer) *SummaryReporter {
+	return &SummaryReporter{w: w, write: Summary.WriteCSV}
+}
+
+func (r *SummaryReporter) OnSummary(summary Summary) {
+	r.write(summary, r.w)
+}
+
+func demoStats() {
+	fmt.Println("演示17：执行统计与导出")
+
+	// 空任务列表也能正常输出摘要
+	NewTaskScheduler(2).RunParallel()
+
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetQuiet(true)
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("步骤%d", i+1)
+		scheduler.AddTaskWithOptions(sleepStep(name, time.Duration(50+i*25)*time.Millisecond, nil), TaskOptions{Name: name})
+	}
+	scheduler.RunParallel()
+
+	summary := scheduler.Summary()
+	summary.WriteText(os.Stdout)
+	fmt.Println("CSV 导出:")
+	summary.WriteCSV(os.Stdout)
+	fmt.Println()
+}
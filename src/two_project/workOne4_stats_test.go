@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmptySummary(t *testing.T) {
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.RunParallel()
+
+	summary := scheduler.Summary()
+	if summary.Total != 0 || summary.SuccessRate != 0 || summary.Speedup != 0 || summary.P99 != 0 {
+		t.Errorf("空任务列表的摘要为 %+v", summary)
+	}
+
+	var text bytes.Buffer
+	if err := summary.WriteText(&text); err != nil || !strings.Contains(text.String(), "没有任务") {
+		t.Errorf("文本摘要为 %q，错误 %v", text.String(), err)
+	}
+
+	// JSON 中的列表输出为 [] 而不是 null，也不会出现 NaN
+	var out bytes.Buffer
+	if err := summary.WriteJSON(&out); err != nil {
+		t.Fatalf("输出 JSON 失败: %v", err)
+	}
+	var report map[string]any
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("JSON 摘要无法解析: %v\n%s", err, out.String())
+	}
+	for _, key := range []string{"tasks", "slowest", "tenants", "breaker_transitions", "never_started"} {
+		if list, ok := report[key].([]any); !ok || len(list) != 0 {
+			t.Errorf("%s 为 %v，应为空列表", key, report[key])
+		}
+	}
+
+	var csv bytes.Buffer
+	if err := summary.WriteCSV(&csv); err != nil || strings.Count(csv.String(), "\n") != 1 {
+		t.Errorf("CSV 应只有表头: %q，错误 %v", csv.String(), err)
+	}
+}
+
+func TestSummaryMakespanAndPercentiles(t *testing.T) {
+	sim := NewSimulation(1)
+	scheduler := NewTaskScheduler(10)
+	scheduler.SetQuiet(true)
+	scheduler.SetSimulation(sim)
+	for i := 1; i <= 10; i++ {
+		d := time.Duration(i) * time.Second
+		scheduler.AddContextTask(func(ctx context.Context) error { return Sleep(ctx, d) })
+	}
+	// 依赖失败而跳过的任务没有执行，不计入耗时分布
+	failed, _ := scheduler.AddTaskWithOptions(func(ctx context.Context) error { return errors.New("失败") }, TaskOptions{})
+	scheduler.AddTaskWithOptions(func(ctx context.Context) error { return nil }, TaskOptions{DependsOn: []int{failed}})
+	runSimulated(t, scheduler, 5*time.Second)
+
+	s := scheduler.Summary()
+	if s.Total != 12 || s.Succeeded != 10 || len(s.NeverStarted) != 1 {
+		t.Errorf("总数 %d，成功 %d，未开始 %d，应为 12、10、1", s.Total, s.Succeeded, len(s.NeverStarted))
+	}
+	// 10 个任务同时开始，墙钟时间等于最长的任务，而不是耗时之和
+	if s.Makespan != 10*time.Second || s.TotalDuration != 55*time.Second || s.Speedup != 5.5 {
+		t.Errorf("墙钟时间 %v，累计耗时 %v，加速比 %v，应为 10s、55s、5.5", s.Makespan, s.TotalDuration, s.Speedup)
+	}
+	// 11 个执行过的任务中有一个耗时 0，最近秩法的 p50 为第 6 小
+	got := []time.Duration{s.P50, s.P90, s.P99, s.MaxDuration, s.AvgDuration}
+	want := []time.Duration{5 * time.Second, 9 * time.Second, 10 * time.Second, 10 * time.Second, 5 * time.Second}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("p50/p90/p99/最大/平均 为 %v，应为 %v", got, want)
+			break
+		}
+	}
+	if len(s.Slowest) != slowestCount || s.Slowest[0].Duration != 10*time.Second {
+		t.Errorf("最慢的任务为 %d 个，第一个耗时 %v", len(s.Slowest), s.Slowest[0].Duration)
+	}
+}
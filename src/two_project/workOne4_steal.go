@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 子任务执行器的类型
+type ExecutorKind int
+
+const (
+	ExecutorSharedQueue  ExecutorKind = iota // 所有 worker 从同一个 channel 取子任务
+	ExecutorWorkStealing                     // 每个 worker 一个本地双端队列，空闲时从其他 worker 窃取
+)
+
+func (k ExecutorKind) String() string {
+	if k == ExecutorWorkStealing {
+		return "工作窃取"
+	}
+	return "共享队列"
+}
+
+// 设置执行 Fork 子任务的执行器，需要在启动前调用
+// 只影响 fork/join 子任务，顶层任务仍由 worker 从就绪队列中取出
+// 子任务由调度器自己的 worker 执行：提交子任务的任务在 Join 时执行排队的子任务，空闲的 worker 也会来帮忙，
+// 不会额外启动协程，同时执行的协程数不超过 worker 数
+// 子任务算作提交它的任务的一部分，不再单独申请资源预算和分组名额
+// 任务中大量 Fork 细粒度的子任务时，使用 ExecutorWorkStealing 可以避免所有 worker 争抢同一个队列
+func (ts *TaskScheduler) SetExecutor(kind ExecutorKind) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.executor = kind
+}
+
+// 子任务队列，其中的子任务由调度器的 worker 执行
+type forkPool interface {
+	attach() *stealWorker                  // 为一个调度器 worker 创建本地队列，共享队列返回 nil
+	detach(w *stealWorker)                 // worker 退出时移除它的本地队列
+	submit(t *forkTask, from *stealWorker) // from 为提交子任务的 worker
+	wait(t *forkTask, from *stealWorker)   // 等待子任务结束，期间执行其他排队的子任务
+	help(w *stealWorker)                   // 执行排队的子任务，直到没有可以执行的为止
+	hasWork() bool                         // 是否有排队的子任务
+	stop()                                 // 停止后 Fork 在当前协程中同步执行
+	isStopped() bool
+}
+
+// wake 在提交子任务后调用，唤醒空闲的调度器 worker
+func newForkPool(kind ExecutorKind, wake func()) forkPool {
+	if kind == ExecutorWorkStealing {
+		return newStealPool(wake)
+	}
+	return newChanPool(wake)
+}
+
+// 两种执行器共用的部分
+type forkBase struct {
+	wake    func()
+	stopped atomic.Bool
+}
+
+func (b *forkBase) stop() {
+	b.stopped.Store(true)
+}
+
+func (b *forkBase) isStopped() bool {
+	return b.stopped.Load()
+}
+
+// worker 执行任务时上下文中携带的子任务队列
+type forkWorkerKey struct{}
+
+type forkWorker struct {
+	pool   forkPool
+	worker *stealWorker
+}
+
+type forkKey struct{}
+
+// 子任务，同时作为子任务执行时的上下文
+type forkTask struct {
+	context.Context              // 提交子任务时的上下文，取消会传递给子任务
+	pool            forkPool     // nil 表示已在提交时同步执行
+	worker          *stealWorker // 执行这个子任务的 worker
+	run             func(ctx context.Context)
+	done            chan struct{}
+	panicked        *PanicError
+}
+
+// 子任务中 Fork 的子任务提交到当前 worker
+func (t *forkTask) Value(key any) any {
+	if key == (forkKey{}) {
+		return t
+	}
+	return t.Context.Value(key)
+}
+
+func (t *forkTask) execute(w *stealWorker) {
+	t.worker = w
+	defer close(t.done)
+	defer func() {
+		if r := recover(); r != nil {
+			// 嵌套的 Join 重新抛出的 panic 保留最里层子任务的堆栈
+			if pe, ok := r.(*PanicError); ok {
+				t.panicked = pe
+				return
+			}
+			t.panicked = newPanicError(r)
+		}
+	}()
+	t.run(t)
+}
+
+// Fork 提交的子任务
+type Forked[T any] struct {
+	task  forkTask
+	owner *stealWorker // 提交子任务的 worker，Join 时在它上面帮忙执行
+	value T
+}
+
+// 提交子任务，由调度器的 worker 与当前任务并行执行，之后用 Join 取得结果
+// ctx 需要来自调度器执行的任务或其他子任务，否则子任务在当前协程中同步执行；
+// 模拟模式下和调度器停止后也同步执行
+// 子任务应当在提交它的任务返回前 Join
+func Fork[T any](ctx context.Context, fn func(ctx context.Context) T) *Forked[T] {
+	f := &Forked[T]{}
+	f.task = forkTask{Context: ctx, done: make(chan struct{})}
+	f.task.run = func(ctx context.Context) { f.value = fn(ctx) }
+
+	var pool forkPool
+	if parent, ok := ctx.Value(forkKey{}).(*forkTask); ok && parent.pool != nil {
+		pool, f.owner = parent.pool, parent.worker
+	} else if env, ok := ctx.Value(taskEnvKey{}).(*taskEnv); ok {
+		pool, f.owner = env.pool, env.worker
+	}
+	if pool == nil || pool.isStopped() {
+		f.task.execute(nil)
+		return f
+	}
+
+	f.task.pool = pool
+	pool.submit(&f.task, f.owner)
+	return f
+}
+
+// 等待子任务结束并返回结果，子任务 panic 时在当前协程中重新抛出
+// 等待期间当前协程会执行其他子任务，不会占着 worker 空等
+func (f *Forked[T]) Join() T {
+	if f.task.pool != nil {
+		f.task.pool.wait(&f.task, f.owner)
+	}
+	if f.task.panicked != nil {
+		panic(f.task.panicked)
+	}
+	return f.value
+}
+
+// 共享队列：所有 worker 从同一个 channel 取子任务，与原来的 taskChan 工作池相同
+type chanPool struct {
+	forkBase
+	tasks chan *forkTask
+}
+
+func newChanPool(wake func()) *chanPool {
+	return &chanPool{
+		forkBase: forkBase{wake: wake},
+		tasks:    make(chan *forkTask, 4096),
+	}
+}
+
+func (p *chanPool) attach() *stealWorker { return nil }
+
+func (p *chanPool) detach(*stealWorker) {}
+
+func (p *chanPool) submit(t *forkTask, _ *stealWorker) {
+	select {
+	case p.tasks <- t:
+		p.wake()
+	default:
+		// 队列已满时直接执行，避免所有 worker 都阻塞在提交上
+		t.execute(nil)
+	}
+}
+
+func (p *chanPool) wait(t *forkTask, _ *stealWorker) {
+	for {
+		select {
+		case <-t.done:
+			return
+		case next := <-p.tasks:
+			next.execute(nil)
+		}
+	}
+}
+
+func (p *chanPool) help(*stealWorker) {
+	for {
+		select {
+		case t := <-p.tasks:
+			t.execute(nil)
+		default:
+			return
+		}
+	}
+}
+
+func (p *chanPool) hasWork() bool {
+	return len(p.tasks) > 0
+}
+
+// 工作窃取：每个 worker 有自己的双端队列，自己从尾部存取（后进先出，缓存友好），
+// 空闲时从其他 worker 的头部窃取（先进先出，窃取到的通常是较大的子任务）
+type stealPool struct {
+	forkBase
+	pending atomic.Int64 // 所有双端队列中的子任务数
+
+	mu      sync.Mutex                     // 保护 workers 的修改
+	workers atomic.Pointer[[]*stealWorker] // 修改时整体替换，窃取时不用加锁
+}
+
+type stealWorker struct {
+	pool *stealPool
+	seed atomic.Uint32 // 选择窃取对象的随机数状态
+
+	mu    sync.Mutex
+	tasks []*forkTask
+	head  int // tasks[head:] 为排队的子任务
+}
+
+func newStealPool(wake func()) *stealPool {
+	p := &stealPool{forkBase: forkBase{wake: wake}}
+	p.workers.Store(&[]*stealWorker{})
+	return p
+}
+
+func (p *stealPool) attach() *stealWorker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	workers := slices.Clone(*p.workers.Load())
+	w := &stealWorker{pool: p}
+	w.seed.Store(uint32(len(workers))*2654435761 + 1)
+	workers = append(workers, w)
+	p.workers.Store(&workers)
+	return w
+}
+
+// worker 只在没有执行任务时退出，这时它的队列已经空了；万一还有剩下的子任务就先执行完
+func (p *stealPool) detach(w *stealWorker) {
+	p.mu.Lock()
+	workers := slices.DeleteFunc(slices.Clone(*p.workers.Load()), func(o *stealWorker) bool { return o == w })
+	p.workers.Store(&workers)
+	p.mu.Unlock()
+
+	for t := w.pop(); t != nil; t = w.pop() {
+		t.execute(w)
+	}
+}
+
+func (p *stealPool) submit(t *forkTask, from *stealWorker) {
+	if from == nil || from.pool != p {
+		// 不在调度器 worker 上提交的子任务直接执行
+		t.execute(nil)
+		return
+	}
+	from.push(t)
+	p.pending.Add(1)
+	p.wake()
+}
+
+func (p *stealPool) wait(t *forkTask, from *stealWorker) {
+	for {
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+		if next := p.find(from); next != nil {
+			next.execute(from)
+			continue
+		}
+		// 找不到其他子任务，说明 t 正在其他 worker 上执行
+		<-t.done
+		return
+	}
+}
+
+func (p *stealPool) help(w *stealWorker) {
+	for t := p.find(w); t != nil; t = p.find(w) {
+		t.execute(w)
+	}
+}
+
+func (p *stealPool) hasWork() bool {
+	return p.pending.Load() > 0
+}
+
+// 先取自己队列中的子任务，没有时从其他 worker 窃取
+func (p *stealPool) find(w *stealWorker) *forkTask {
+	start := 0
+	if w != nil {
+		if t := w.pop(); t != nil {
+			return t
+		}
+		start = int(w.random())
+	}
+	workers := *p.workers.Load()
+	n := len(workers)
+	for i := 0; i < n; i++ {
+		victim := workers[(start+i)%n]
+		if victim == w {
+			continue
+		}
+		if t := victim.steal(); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+func (w *stealWorker) push(t *forkTask) {
+	w.mu.Lock()
+	w.tasks = append(w.tasks, t)
+	w.mu.Unlock()
+}
+
+// 从尾部取出自己最近提交的子任务
+func (w *stealWorker) pop() *forkTask {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.tasks) == w.head {
+		return nil
+	}
+	t := w.tasks[len(w.tasks)-1]
+	w.tasks[len(w.tasks)-1] = nil
+	w.tasks = w.tasks[:len(w.tasks)-1]
+	w.resetLocked()
+	w.pool.pending.Add(-1)
+	return t
+}
+
+// 从头部窃取最早提交的子任务
+func (w *stealWorker) steal() *forkTask {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.tasks) == w.head {
+		return nil
+	}
+	t := w.tasks[w.head]
+	w.tasks[w.head] = nil
+	w.head++
+	w.resetLocked()
+	w.pool.pending.Add(-1)
+	return t
+}
+
+// 队列为空时重新从切片开头存放
+func (w *stealWorker) resetLocked() {
+	if len(w.tasks) == w.head {
+		w.tasks = w.tasks[:0]
+		w.head = 0
+	}
+}
+
+// xorshift 随机数；任务自己启动的协程也可能用同一个 worker 提交和等待子任务，状态用原子操作更新
+func (w *stealWorker) random() uint32 {
+	for {
+		old := w.seed.Load()
+		x := old
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		if w.seed.CompareAndSwap(old, x) {
+			return x
+		}
+	}
+}
+
+// 用 fork/join 递归计算斐波那契数，n 小于 cutoff 时不再拆分
+func forkFib(ctx context.Context, n, cutoff int) int {
+	if n < 2 {
+		return n
+	}
+	if n < cutoff {
+		return forkFib(ctx, n-1, cutoff) + forkFib(ctx, n-2, cutoff)
+	}
+	left := Fork(ctx, func(ctx context.Context) int { return forkFib(ctx, n-1, cutoff) })
+	right := forkFib(ctx, n-2, cutoff)
+	return left.Join() + right
+}
+
+// 一次提交大量很小的子任务，再全部 Join
+func forkFlat(ctx context.Context, n int) int {
+	parts := make([]*Forked[int], n)
+	for i := range parts {
+		parts[i] = Fork(ctx, func(ctx context.Context) int { return i * i % 7 })
+	}
+	sum := 0
+	for _, part := range parts {
+		sum += part.Join()
+	}
+	return sum
+}
+
+func demoWorkStealing() {
+	fmt.Println("演示28：工作窃取执行器与 fork/join 子任务")
+
+	scheduler := NewTaskScheduler(4)
+	scheduler.SetQuiet(true)
+	scheduler.SetExecutor(ExecutorWorkStealing)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	// 递归拆分的子任务在各 worker 的本地队列中执行，空闲的 worker 窃取其他 worker 的子任务
+	fib := Submit(scheduler, func(ctx context.Context) (int, error) {
+		return forkFib(ctx, 25, 10), nil
+	}, TaskOptions{Name: "fib(25)"})
+	r := fib.AwaitResult()
+	fmt.Printf("%s = %d，耗时 %v\n", r.Name, r.Value, r.Duration.Round(time.Microsecond))
+
+	flat := Submit(scheduler, func(ctx context.Context) (int, error) {
+		return forkFlat(ctx, 10000), nil
+	}, TaskOptions{Name: "1 万个小任务"})
+	r = flat.AwaitResult()
+	fmt.Printf("%s 的和 = %d，耗时 %v\n", r.Name, r.Value, r.Duration.Round(time.Microsecond))
+
+	// 子任务 panic 时在 Join 处重新抛出，整个任务记为 panic
+	broken := Submit(scheduler, func(ctx context.Context) (int, error) {
+		part := Fork(ctx, func(ctx context.Context) int {
+			var items []int
+			return items[3]
+		})
+		return part.Join(), nil
+	}, TaskOptions{Name: "越界的子任务"})
+	r = broken.AwaitResult()
+	fmt.Printf("%s: 状态 %s，错误: %v\n", r.Name, r.Status, r.Error)
+
+	// 不在调度器中执行时，子任务在当前协程中同步执行
+	fmt.Printf("调度器外 fib(15) = %d\n", forkFib(context.Background(), 15, 5))
+	fmt.Println("性能对比: go test -run '^$' -bench Fork workOne4*.go")
+	fmt.Println()
+}
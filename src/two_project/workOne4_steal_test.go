@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var executors = []ExecutorKind{ExecutorSharedQueue, ExecutorWorkStealing}
+
+// 并发执行的子任务计数
+type concurrency struct {
+	active, peak atomic.Int32
+}
+
+func (c *concurrency) run(d time.Duration) {
+	n := c.active.Add(1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(d)
+	c.active.Add(-1)
+}
+
+func forkSleeps(ctx context.Context, c *concurrency, n int) {
+	parts := make([]*Forked[struct{}], n)
+	for i := range parts {
+		parts[i] = Fork(ctx, func(ctx context.Context) struct{} {
+			c.run(5 * time.Millisecond)
+			return struct{}{}
+		})
+	}
+	for _, part := range parts {
+		part.Join()
+	}
+}
+
+func TestForkRunsOnSchedulerWorkers(t *testing.T) {
+	for _, kind := range executors {
+		scheduler := NewTaskScheduler(2)
+		scheduler.SetQuiet(true)
+		scheduler.SetExecutor(kind)
+		scheduler.Start()
+
+		// 另一个 worker 正忙时，子任务只在提交它的任务所在的 worker 上执行
+		release := make(chan struct{})
+		blocker, _ := scheduler.Submit(func(ctx context.Context) error {
+			<-release
+			return nil
+		}, TaskOptions{})
+		var busy concurrency
+		forked := Submit(scheduler, func(ctx context.Context) (int, error) {
+			forkSleeps(ctx, &busy, 8)
+			return forkFib(ctx, 15, 5), nil
+		}, TaskOptions{})
+		if v, err := forked.Await(); err != nil || v != 610 {
+			t.Errorf("%s: fib(15) = %d，错误 %v，应为 610", kind, v, err)
+		}
+		if peak := busy.peak.Load(); peak != 1 {
+			t.Errorf("%s: 另一个 worker 正忙时子任务的并发数为 %d，应为 1", kind, peak)
+		}
+		close(release)
+		scheduler.Wait(blocker)
+
+		// 空闲的 worker 帮忙执行子任务，并发数不超过 worker 数
+		var idle concurrency
+		forked = Submit(scheduler, func(ctx context.Context) (int, error) {
+			forkSleeps(ctx, &idle, 8)
+			return 0, nil
+		}, TaskOptions{})
+		forked.Await()
+		if peak := idle.peak.Load(); peak > 2 {
+			t.Errorf("%s: 子任务的并发数为 %d，超过了 worker 数 2", kind, peak)
+		}
+		scheduler.Drain()
+	}
+}
+
+func TestForkPanicPropagatesThroughJoin(t *testing.T) {
+	for _, kind := range executors {
+		scheduler := NewTaskScheduler(2)
+		scheduler.SetQuiet(true)
+		scheduler.SetExecutor(kind)
+		scheduler.Start()
+
+		// 两层子任务，最里层的 panic 经过两次 Join 传到任务
+		f := Submit(scheduler, func(ctx context.Context) (int, error) {
+			outer := Fork(ctx, func(ctx context.Context) int {
+				inner := Fork(ctx, func(ctx context.Context) int {
+					panic("子任务出错")
+				})
+				return inner.Join()
+			})
+			return outer.Join(), nil
+		}, TaskOptions{})
+		r := f.AwaitResult()
+		var pe *PanicError
+		if r.Status != StatusPanicked || !errors.As(r.Error, &pe) || pe.Value != "子任务出错" {
+			t.Errorf("%s: 子任务 panic 后任务状态为 %s，错误为 %v", kind, r.Status, r.Error)
+		}
+
+		// panic 之后 worker 照常执行其他子任务
+		f = Submit(scheduler, func(ctx context.Context) (int, error) {
+			return forkFib(ctx, 10, 3), nil
+		}, TaskOptions{})
+		if v, err := f.Await(); err != nil || v != 55 {
+			t.Errorf("%s: panic 之后 fib(10) = %d，错误 %v", kind, v, err)
+		}
+		scheduler.Drain()
+	}
+}
+
+func TestForkAfterPoolStopsRunsInline(t *testing.T) {
+	for _, kind := range executors {
+		scheduler := NewTaskScheduler(2)
+		scheduler.SetQuiet(true)
+		scheduler.SetExecutor(kind)
+		scheduler.Start()
+
+		ctxs := make(chan context.Context, 1)
+		taskID, _ := scheduler.Submit(func(ctx context.Context) error {
+			ctxs <- ctx
+			return nil
+		}, TaskOptions{})
+		scheduler.Wait(taskID)
+		scheduler.Drain()
+
+		// 调度器停止后，用任务留下的上下文 Fork 的子任务在当前协程中同步执行
+		ctx := <-ctxs
+		ran := false
+		part := Fork(ctx, func(ctx context.Context) int {
+			ran = true
+			return forkFib(ctx, 10, 3)
+		})
+		if !ran {
+			t.Errorf("%s: 停止后的子任务没有在 Fork 时同步执行", kind)
+		}
+		if v := part.Join(); v != 55 {
+			t.Errorf("%s: 停止后 fib(10) = %d，应为 55", kind, v)
+		}
+
+		// 同步执行的子任务 panic 同样在 Join 时抛出
+		broken := Fork(ctx, func(ctx context.Context) int { panic("停止后出错") })
+		func() {
+			defer func() {
+				if pe, ok := recover().(*PanicError); !ok || pe.Value != "停止后出错" {
+					t.Errorf("%s: Join 没有重新抛出子任务的 panic", kind)
+				}
+			}()
+			broken.Join()
+		}()
+	}
+}
+
+// 每次迭代提交一个调度器任务，在任务中 fork/join，worker 数与 GOMAXPROCS 相同
+func benchmarkExecutor(b *testing.B, kind ExecutorKind, fn func(ctx context.Context) int) {
+	scheduler := NewTaskScheduler(runtime.GOMAXPROCS(0))
+	scheduler.SetQuiet(true)
+	scheduler.SetExecutor(kind)
+	scheduler.Start()
+	defer scheduler.Drain()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f := Submit(scheduler, func(ctx context.Context) (int, error) {
+			return fn(ctx), nil
+		}, TaskOptions{})
+		if _, err := f.Await(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 递归 fib(27)，每层都拆分
+func fib27(ctx context.Context) int { return forkFib(ctx, 27, 2) }
+
+// 递归 fib(30)，小于 15 时不再拆分
+func fib30Cutoff(ctx context.Context) int { return forkFib(ctx, 30, 15) }
+
+// 一次提交 10 万个小任务
+func flat100k(ctx context.Context) int { return forkFlat(ctx, 100000) }
+
+func BenchmarkForkFib_SharedQueue(b *testing.B) {
+	benchmarkExecutor(b, ExecutorSharedQueue, fib27)
+}
+
+func BenchmarkForkFib_WorkStealing(b *testing.B) {
+	benchmarkExecutor(b, ExecutorWorkStealing, fib27)
+}
+
+func BenchmarkForkFibCutoff_SharedQueue(b *testing.B) {
+	benchmarkExecutor(b, ExecutorSharedQueue, fib30Cutoff)
+}
+
+func BenchmarkForkFibCutoff_WorkStealing(b *testing.B) {
+	benchmarkExecutor(b, ExecutorWorkStealing, fib30Cutoff)
+}
+
+func BenchmarkForkFlat_SharedQueue(b *testing.B) {
+	benchmarkExecutor(b, ExecutorSharedQueue, flat100k)
+}
+
+func BenchmarkForkFlat_WorkStealing(b *testing.B) {
+	benchmarkExecutor(b, ExecutorWorkStealing, flat100k)
+}
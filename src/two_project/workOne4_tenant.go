@@ -0,0 +1,266 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// 单个租户的排队任务
+type tenantQueue struct {
+	name    string
+	weight  float64
+	items   taskHeap // 可以出队的任务
+	parked  int      // 被限流暂时移出 items 的任务数
+	running int      // 已取出但还没结束的任务数
+	vtime   float64  // 虚拟时间：已取出的任务数 / 权重
+	peak    int      // 最大排队长度
+	index   int      // 在 readyQueue.fair 中的位置，不在其中时为 -1
+}
+
+// 排队中的任务数，包括被限流的
+func (t *tenantQueue) queued() int {
+	return len(t.items) + t.parked
+}
+
+// 加权公平排队：每次把 worker 分给 正在运行的任务数/权重 最小的租户，
+// 相同时选虚拟时间小的，因此各租户占用的 worker 数与权重成正比。
+// 某个租户没有任务排队时，它的份额由其他租户使用
+//
+// 有可出队任务的租户按这个顺序放在最小堆中，取出任务、任务结束或调整权重时更新位置
+type tenantHeap []*tenantQueue
+
+func (h tenantHeap) Len() int { return len(h) }
+
+func (h tenantHeap) Less(i, j int) bool {
+	a, b := h[i], h[j]
+	if la, lb := float64(a.running)/a.weight, float64(b.running)/b.weight; la != lb {
+		return la < lb
+	}
+	if a.vtime != b.vtime {
+		return a.vtime < b.vtime
+	}
+	return a.name < b.name
+}
+
+func (h tenantHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *tenantHeap) Push(x any) {
+	t := x.(*tenantQueue)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *tenantHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
+
+// 租户的排序键变化后调整它在堆中的位置
+func (q *readyQueue) fixTenantLocked(t *tenantQueue) {
+	if t.index >= 0 {
+		heap.Fix(&q.fair, t.index)
+	}
+}
+
+// 租户开始排队时，虚拟时间追上其他排队中的租户，空闲期间不积累份额
+func (t *tenantQueue) activateLocked(q *readyQueue) {
+	floor, found := 0.0, false
+	for _, other := range q.tenants {
+		if other != t && other.queued() > 0 && (!found || other.vtime < floor) {
+			floor, found = other.vtime, true
+		}
+	}
+	if found {
+		t.vtime = max(t.vtime, floor)
+	}
+}
+
+// 租户的任务被 worker 取出
+func (t *tenantQueue) dispatchLocked() {
+	t.running++
+	t.vtime += 1 / t.weight
+}
+
+// 取出的任务执行结束
+func (q *readyQueue) finish(item *queuedTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t := q.tenantLocked(item.entry.tenant)
+	t.running--
+	q.fixTenantLocked(t)
+}
+
+// 调整租户权重
+func (q *readyQueue) setWeight(tenant string, weight float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t := q.tenantLocked(tenant)
+	t.weight = weight
+	q.fixTenantLocked(t)
+	q.cond.Broadcast()
+}
+
+// 各租户当前和最大的排队长度
+func (q *readyQueue) tenantDepths() map[string][2]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	depths := make(map[string][2]int)
+	for name, t := range q.tenants {
+		if t.peak > 0 {
+			depths[name] = [2]int{t.queued(), t.peak}
+		}
+	}
+	return depths
+}
+
+// 设置租户权重，默认为 1。同时有任务排队时，各租户占用的 worker 数与权重成正比
+// 可以在运行中调整
+func (ts *TaskScheduler) SetTenantWeight(tenant string, weight float64) {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.weights == nil {
+		ts.weights = make(map[string]float64)
+	}
+	ts.weights[tenant] = weight
+	if ts.queue != nil {
+		ts.queue.setWeight(tenant, weight)
+	}
+}
+
+// 单个租户的统计
+type TenantSummary struct {
+	Tenant     string
+	Weight     float64
+	Total      int // 已结束的任务数
+	Succeeded  int
+	Queued     int // 当前排队的任务数
+	PeakQueued int // 最大排队长度
+
+	// 延迟：从入队到结束的平均时间，以及排队等待时间的分布
+	AvgLatency   time.Duration
+	AvgQueueWait time.Duration
+	P90QueueWait time.Duration
+	MaxQueueWait time.Duration
+}
+
+// 按租户汇总已结束的任务，结果按租户名排序
+func (ts *TaskScheduler) tenantSummaryLocked(results []TaskResult) []TenantSummary {
+	byTenant := make(map[string]*TenantSummary)
+	get := func(tenant string) *TenantSummary {
+		s, ok := byTenant[tenant]
+		if !ok {
+			s = &TenantSummary{Tenant: tenant, Weight: 1}
+			if weight, ok := ts.weights[tenant]; ok {
+				s.Weight = weight
+			}
+			byTenant[tenant] = s
+		}
+		return s
+	}
+
+	waits := make(map[string][]time.Duration)
+	latency := make(map[string]time.Duration)
+	for _, result := range results {
+		s := get(result.Tenant)
+		s.Total++
+		if result.Success {
+			s.Succeeded++
+		}
+		if result.Started {
+			waits[result.Tenant] = append(waits[result.Tenant], result.QueueWait)
+			latency[result.Tenant] += result.EndTime.Sub(result.QueuedAt)
+		}
+	}
+	if ts.queue != nil {
+		for tenant, depth := range ts.queue.tenantDepths() {
+			s := get(tenant)
+			s.Queued, s.PeakQueued = depth[0], depth[1]
+		}
+	}
+
+	tenants := make([]TenantSummary, 0, len(byTenant))
+	for tenant, s := range byTenant {
+		if w := waits[tenant]; len(w) > 0 {
+			s.AvgLatency = latency[tenant] / time.Duration(len(w))
+			sort.Slice(w, func(i, j int) bool { return w[i] > w[j] })
+			var total time.Duration
+			for _, d := range w {
+				total += d
+			}
+			s.AvgQueueWait = total / time.Duration(len(w))
+			s.P90QueueWait = w[len(w)-max(percentileRank(len(w), 90), 1)]
+			s.MaxQueueWait = w[0]
+		}
+		tenants = append(tenants, *s)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Tenant < tenants[j].Tenant })
+	return tenants
+}
+
+func tenantLabel(tenant string) string {
+	if tenant == "" {
+		return "(默认)"
+	}
+	return tenant
+}
+
+// 输出各租户的统计
+func writeTenants(w io.Writer, tenants []TenantSummary) {
+	for _, t := range tenants {
+		fmt.Fprintf(w, "  %s（权重 %g）: 完成 %d，成功 %d，排队 %d（最多 %d），平均延迟 %v，排队等待 平均 %v / p90 %v / 最大 %v\n",
+			tenantLabel(t.Tenant), t.Weight, t.Total, t.Succeeded, t.Queued, t.PeakQueued, t.AvgLatency.Round(time.Millisecond),
+			t.AvgQueueWait.Round(time.Millisecond), t.P90QueueWait.Round(time.Millisecond), t.MaxQueueWait.Round(time.Millisecond))
+	}
+}
+
+func demoTenants() {
+	fmt.Println("演示25：多租户加权公平调度")
+
+	work := func(ctx context.Context) error {
+		sleepContext(ctx, 100*time.Millisecond)
+		return ctx.Err()
+	}
+
+	// 批量租户先提交了一大批任务，在线租户随后提交少量任务
+	run := func(onlineWeight float64) {
+		scheduler := NewTaskScheduler(4)
+		scheduler.SetQuiet(true)
+		scheduler.SetTenantWeight("在线", onlineWeight)
+		for i := 0; i < 16; i++ {
+			name := fmt.Sprintf("批量%d", i+1)
+			scheduler.AddTaskWithOptions(work, TaskOptions{Name: name, Tenant: "批量"})
+		}
+		for i := 0; i < 6; i++ {
+			name := fmt.Sprintf("在线%d", i+1)
+			scheduler.AddTaskWithOptions(work, TaskOptions{Name: name, Tenant: "在线"})
+		}
+		scheduler.RunParallel()
+		writeTenants(os.Stdout, scheduler.Summary().Tenants)
+	}
+
+	fmt.Println("权重相同，两个租户各占一半 worker:")
+	run(1)
+	fmt.Println("在线租户权重为 3，占 4 个 worker 中的 3 个:")
+	run(3)
+	fmt.Println()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeoutStatus(t *testing.T) {
+	scheduler := NewTaskScheduler(2)
+	scheduler.SetQuiet(true)
+	scheduler.SetTimeout(20 * time.Millisecond)
+	scheduler.AddContextTask(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	scheduler.AddContextTask(func(ctx context.Context) error { return nil })
+	scheduler.RunParallel()
+
+	results := scheduler.GetResults()
+	if r := results[0]; r.Status != StatusTimeout || !errors.Is(r.Error, ErrTaskTimeout) {
+		t.Errorf("超时任务状态为 %s，错误为 %v，应为超时且包含 ErrTaskTimeout", r.Status, r.Error)
+	}
+	if r := results[1]; r.Status != StatusSuccess || !r.Success {
+		t.Errorf("未超时的任务状态为 %s，应为成功", r.Status)
+	}
+}
+
+func TestCancelStopsRunningAndQueuedTasks(t *testing.T) {
+	scheduler := NewTaskScheduler(1)
+	scheduler.SetQuiet(true)
+	started := make(chan struct{})
+	scheduler.AddContextTask(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	scheduler.AddContextTask(func(ctx context.Context) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	scheduler.RunParallelContext(ctx)
+
+	for i, r := range scheduler.GetResults() {
+		if r.Status != StatusCancelled || !errors.Is(r.Error, context.Canceled) {
+			t.Errorf("任务 %d 状态为 %s，错误为 %v，应为已取消", i+1, r.Status, r.Error)
+		}
+	}
+	if results := scheduler.GetResults(); !results[0].Started || results[1].Started {
+		t.Errorf("只有第一个任务应当开始执行: %v %v", results[0].Started, results[1].Started)
+	}
+}
+
+func TestAdaptTaskReturnsOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	task := AdaptTask(func() error {
+		<-release
+		return nil
+	})
+
+	// 旧任务无法被中断，但适配后的任务在上下文取消后立即返回
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := task(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后返回 %v，应为 context.Canceled", err)
+	}
+
+	broken := AdaptTask(func() error { panic("旧任务出错") })
+	var pe *PanicError
+	if err := broken(context.Background()); !errors.As(err, &pe) {
+		t.Errorf("旧任务 panic 后返回 %v，应为 *PanicError", err)
+	}
+}